@@ -18,6 +18,9 @@ interface ChatMessage {
 // The structure of a source document from the backend
 interface SourceDoc {
   text: string;
+  page_start?: number;
+  page_end?: number;
+  citation?: string; // e.g. "report.pdf p. 12"
   metadata?: {
     source_file?: string;
     chunk_num?: number;
@@ -211,7 +214,7 @@ export const RAGComponent = ({ settings, events }: RAGComponentProps) => {
               <div className="rag-sources">
                 <strong>Sources:</strong>
                 {msg.sources.map((doc, idx) => (
-                  <details key={idx}><summary>{doc.metadata?.source_file?.split('/').pop() || 'User Note'}</summary><div className="rag-sources-content"><p>{doc.text}</p></div></details>
+                  <details key={idx}><summary>{doc.citation || doc.metadata?.source_file?.split('/').pop() || 'User Note'}</summary><div className="rag-sources-content"><p>{doc.text}</p></div></details>
                 ))}
               </div>)}
               <div className="message-actions">
@@ -30,7 +30,7 @@ function QueryResults({ result, loading, error }) {
                 >
                   <Typography variant="body2" sx={{ fontWeight: 'bold' }}>
                     {/* Display filename from metadata */}
-                    Source {idx + 1}: {doc.metadata?.source_file?.split('/').pop() || 'User Note'}
+                    Source {idx + 1}: {doc.citation || doc.metadata?.source_file?.split('/').pop() || 'User Note'}
                   </Typography>
                 </AccordionSummary>
                 <AccordionDetails sx={{ backgroundColor: 'rgba(0, 0, 0, 0.03)' }}>
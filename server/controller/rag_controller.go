@@ -1,7 +1,11 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -14,13 +18,15 @@ import (
 // RAGService to perform the actual business logic.
 type RAGController struct {
 	ragService services.RAGService
+	indexer    services.IndexProgress
 }
 
 // NewRAGController is a constructor function that creates a new RAGController.
-// This is called from main.go to inject the service dependency.
-func NewRAGController(service services.RAGService) *RAGController {
+// This is called from main.go to inject the service dependencies.
+func NewRAGController(service services.RAGService, indexer services.IndexProgress) *RAGController {
 	return &RAGController{
 		ragService: service,
+		indexer:    indexer,
 	}
 }
 
@@ -33,12 +39,21 @@ func (c *RAGController) GetIndexStatus(ctx *gin.Context) {
 		return
 	}
 
-	// For now, we are just returning total chunks. This can be expanded later.
-	// We'll return a placeholder for totalFiles for now.
-	ctx.JSON(http.StatusOK, gin.H{
-		"totalFiles":  0, // Placeholder - implementing this requires more complex logic
-		"totalChunks": count,
-	})
+	status := c.indexer.IndexStatus()
+	status.TotalChunks = count
+	status.EmbeddingCache = c.ragService.GetEmbeddingCacheStats()
+	ctx.JSON(http.StatusOK, status)
+}
+
+// GetIndexJobs is the Gin handler for the GET /api/v1/index/jobs endpoint. It
+// lists the indexing state of each file, optionally only those in ?state=.
+func (c *RAGController) GetIndexJobs(ctx *gin.Context) {
+	state := ctx.Query("state")
+	if state != "" && !services.ValidJobState(state) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown state: " + state})
+		return
+	}
+	ctx.JSON(http.StatusOK, c.indexer.IndexJobs(state))
 }
 
 // IngestNote is the Gin handler for the POST /api/v1/notes endpoint.
@@ -84,9 +99,16 @@ func (c *RAGController) QueryRAG(ctx *gin.Context) {
 		return
 	}
 
+	retrieval, err := parseRetrievalOptions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	req := models.QueryTextRequest{
 		Query:     query,
 		SessionID: sessionID,
+		Retrieval: retrieval,
 	}
 
 	// Delegate the complex RAG pipeline logic to the service layer.
@@ -115,3 +137,126 @@ func (c *RAGController) GetAllNotes(ctx *gin.Context) {
 	// On success, return a 200 OK status with the response data from the service.
 	ctx.JSON(http.StatusOK, response)
 }
+
+// GetNoteLinks is the Gin handler for the GET /api/v1/links endpoint. The note
+// query parameter is a path or wikilink target; depth (default 1) sets how
+// many links away the returned neighborhood reaches.
+func (c *RAGController) GetNoteLinks(ctx *gin.Context) {
+	note := ctx.Query("note")
+	if note == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "note is required"})
+		return
+	}
+	depth := 0
+	if raw := ctx.Query("depth"); raw != "" {
+		var err error
+		if depth, err = strconv.Atoi(raw); err != nil || depth <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "depth must be a positive integer"})
+			return
+		}
+	}
+
+	response, err := c.ragService.GetNoteLinks(ctx.Request.Context(), note, depth)
+	if errors.Is(err, services.ErrNoteNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Note not found in link graph"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get note links"})
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// parseRetrievalOptions reads the optional retrieval tuning fields from the form.
+func parseRetrievalOptions(ctx *gin.Context) (models.RetrievalOptions, error) {
+	var opts models.RetrievalOptions
+	var err error
+	if opts.VectorWeight, err = optionalFloatForm(ctx, "vectorWeight"); err != nil {
+		return opts, err
+	}
+	if opts.LexicalWeight, err = optionalFloatForm(ctx, "lexicalWeight"); err != nil {
+		return opts, err
+	}
+	if opts.Rerank, err = optionalBoolForm(ctx, "rerank"); err != nil {
+		return opts, err
+	}
+	if raw := ctx.PostForm("k"); raw != "" {
+		if opts.K, err = strconv.Atoi(raw); err != nil || opts.K <= 0 {
+			return opts, fmt.Errorf("k must be a positive integer")
+		}
+	}
+	if opts.MMR, err = optionalBoolForm(ctx, "mmr"); err != nil {
+		return opts, err
+	}
+	if opts.MMRLambda, err = optionalFloatForm(ctx, "mmrLambda"); err != nil {
+		return opts, err
+	}
+	if opts.MMRLambda != nil && *opts.MMRLambda > 1 {
+		return opts, fmt.Errorf("mmrLambda must be between 0 and 1")
+	}
+	switch opts.Expand = ctx.PostForm("expand"); opts.Expand {
+	case "", services.ExpandNeighbors, services.ExpandSection:
+	default:
+		return opts, fmt.Errorf("expand must be %q or %q", services.ExpandNeighbors, services.ExpandSection)
+	}
+	if raw := ctx.PostForm("expandWindow"); raw != "" {
+		if opts.ExpandWindow, err = strconv.Atoi(raw); err != nil || opts.ExpandWindow <= 0 {
+			return opts, fmt.Errorf("expandWindow must be a positive integer")
+		}
+	}
+	if expandLinks, err := optionalBoolForm(ctx, "expandLinks"); err != nil {
+		return opts, err
+	} else if expandLinks != nil {
+		opts.ExpandLinks = *expandLinks
+	}
+
+	opts.Filter = models.RetrievalFilter{
+		SourceFile:     ctx.PostForm("source_file"),
+		Folder:         ctx.PostForm("folder"),
+		ModifiedAfter:  ctx.PostForm("modified_after"),
+		ModifiedBefore: ctx.PostForm("modified_before"),
+	}
+	// Tags may be repeated (tags=a&tags=b) or comma-separated (tags=a,b).
+	for _, raw := range ctx.PostFormArray("tags") {
+		for _, tag := range strings.Split(raw, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				opts.Filter.Tags = append(opts.Filter.Tags, tag)
+			}
+		}
+	}
+	// Record fields are given as fields[name]=value.
+	if fields := ctx.PostFormMap("fields"); len(fields) > 0 {
+		opts.Filter.Fields = fields
+	}
+	if err := services.ValidateRetrievalFilter(opts.Filter); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// optionalBoolForm parses a boolean form field, returning nil when it is absent.
+func optionalBoolForm(ctx *gin.Context, field string) (*bool, error) {
+	raw := ctx.PostForm(field)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", field)
+	}
+	return &v, nil
+}
+
+// optionalFloatForm parses a non-negative float form field, returning nil when it is absent.
+func optionalFloatForm(ctx *gin.Context, field string) (*float64, error) {
+	raw := ctx.PostForm(field)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative number", field)
+	}
+	return &v, nil
+}
@@ -64,11 +64,75 @@ func main() {
 	}
 	log.Printf("FileActions service initialized with notes directory: %s", fileActions.NotesDir)
 
+	embedder, err := services.NewEmbedderFromEnv(httpClient)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to create embedder: %v", err)
+	}
+	log.Printf("Using embedding model: %s", embedder.ModelName())
+
+	// Indexing workers and queries share the model server, so cap how many
+	// embedding requests it gets at once (match OLLAMA_NUM_PARALLEL).
+	embedder = services.NewLimitedEmbedder(embedder)
+
+	// Wrap the embedder with the on-disk cache unless it has been switched off.
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	if os.Getenv("EMBED_CACHE") != "off" {
+		cachingEmbedder, err := services.NewCachingEmbedder(embedder, filepath.Join(dataDir, "embedding_cache.bin"))
+		if err != nil {
+			log.Fatalf("FATAL: Failed to open embedding cache: %v", err)
+		}
+		defer func() {
+			if err := cachingEmbedder.Close(); err != nil {
+				log.Printf("Warning: Failed to close embedding cache: %v", err)
+			}
+		}()
+		embedder = cachingEmbedder
+	}
+
+	lexicalIndex, err := services.NewLexicalIndex(filepath.Join(dataDir, "bm25_index.json"))
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load lexical index: %v", err)
+	}
+	linkGraph, err := services.NewLinkGraph(filepath.Join(dataDir, "link_graph.json"))
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load link graph: %v", err)
+	}
+	indexManifest, err := services.NewIndexManifest(filepath.Join(dataDir, "index_manifest.json"))
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load index manifest: %v", err)
+	}
+
+	reranker, err := services.NewRerankerFromEnv(httpClient, geminiClient)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to create reranker: %v", err)
+	}
+	if reranker != nil {
+		log.Printf("Reranking enabled with: %s", reranker.Name())
+	}
+
 	// Use the proper constructor function
-	ragService := services.NewRAGService(httpClient, collection, geminiClient, fileActions)
-	ragController := controller.NewRAGController(ragService)
+	ragService := services.NewRAGService(httpClient, collection, embedder, lexicalIndex, linkGraph, indexManifest, reranker, geminiClient, fileActions)
 
-	indexingService := services.NewFileIndexingService(collection, ragService)
+	pdfBackend, err := services.NewPDFBackendFromEnv()
+	if err != nil {
+		log.Fatalf("FATAL: Failed to configure PDF backend: %v", err)
+	}
+	services.SetPDFBackend(pdfBackend)
+	log.Printf("Using PDF backend: %s", pdfBackend.Name())
+
+	tokenizer, err := services.NewTokenizerFromEnv()
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load tokenizer: %v", err)
+	}
+	chunkers, err := services.NewChunkerRegistryFromEnv(tokenizer)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load chunker config: %v", err)
+	}
+	indexingService := services.NewFileIndexingService(collection, embedder, lexicalIndex, linkGraph, indexManifest, chunkers, tokenizer)
+	ragController := controller.NewRAGController(ragService, indexingService)
 
 	indexPath := os.Getenv("INDEX_PATH")
 	if indexPath == "" {
@@ -81,8 +145,10 @@ func main() {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel() // Only cancel on server shutdown
 
-			// Run the initial scan
-			indexingService.ScanAndIndexDirectory(ctx, absPath)
+			// Run the initial scan in the background so the API is available
+			// right away. The watcher starts alongside it and catches changes
+			// made while the scan runs.
+			go indexingService.ScanAndIndexDirectory(ctx, absPath)
 
 			// Start the real-time watcher (in a goroutine so it doesn't block)
 			go indexingService.WatchDirectory(ctx, absPath)
@@ -122,6 +188,8 @@ func main() {
 		apiV1.GET("/notes", ragController.GetAllNotes) // Endpoint to get all notes
 		apiV1.POST("/query", ragController.QueryRAG)   // Endpoint to ask a question
 		apiV1.GET("/status", ragController.GetIndexStatus)
+		apiV1.GET("/index/jobs", ragController.GetIndexJobs) // Per-file indexing state
+		apiV1.GET("/links", ragController.GetNoteLinks)      // Backlinks and link neighborhood of a note
 	}
 
 	// Start the Server
@@ -15,6 +15,45 @@ type GetAllNotesResponse struct {
 
 // SourceDocument represents a chunk of text and its origin.
 type SourceDocument struct {
-	Text     string                 `json:"text"`
+	ID         string `json:"id"`
+	Text       string `json:"text"`
+	SourceFile string `json:"source_file,omitempty"`
+	ChunkNum   int    `json:"chunk_num"`
+	// CharStart and CharEnd delimit the chunk in the extracted file text, in
+	// characters (runes). They are -1 when the position is unknown.
+	CharStart int `json:"char_start"`
+	CharEnd   int `json:"char_end"`
+	// PageStart and PageEnd are the 1-based pages a PDF chunk spans; they are
+	// omitted for files without pages.
+	PageStart int `json:"page_start,omitempty"`
+	PageEnd   int `json:"page_end,omitempty"`
+	// Citation names the chunk's source for display, e.g. "report.pdf p. 12".
+	Citation string `json:"citation,omitempty"`
+	// Distance is the raw ChromaDB distance, absent for chunks found only by keyword search.
+	Distance *float64 `json:"distance,omitempty"`
+	// Score is the final relevance score used for ranking (higher is better):
+	// the rerank score when reranking ran, otherwise the fused RRF score.
+	Score    float64                `json:"score"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
+
+// NoteLinksResponse is the structure for the response of the GET /links endpoint.
+type NoteLinksResponse struct {
+	Note string `json:"note"`
+	// Outgoing lists the notes this note links to, Backlinks the notes that
+	// link to it, and Unresolved the link targets that match no indexed note.
+	Outgoing   []string `json:"outgoing"`
+	Backlinks  []string `json:"backlinks"`
+	Unresolved []string `json:"unresolved"`
+	// Nodes are the notes within Depth links of the note in either
+	// direction, and Edges the links between them.
+	Depth int        `json:"depth"`
+	Nodes []string   `json:"nodes"`
+	Edges []LinkEdge `json:"edges"`
+}
+
+// LinkEdge is a wikilink from one note to another.
+type LinkEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
@@ -10,3 +10,14 @@ type OllamaEmbedRequest struct {
 type OllamaEmbedResponse struct {
 	Embedding []float32 `json:"embedding"`
 }
+
+// OllamaEmbedBatchRequest is used to embed several inputs with the Ollama /api/embed API.
+type OllamaEmbedBatchRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedBatchResponse is used to parse the embeddings from the Ollama /api/embed response.
+type OllamaEmbedBatchResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
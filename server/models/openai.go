@@ -0,0 +1,18 @@
+package models
+
+// OpenAIEmbedRequest is used to structure the request to an OpenAI-compatible /v1/embeddings API.
+type OpenAIEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OpenAIEmbedResponse is used to parse the embeddings from an OpenAI-compatible API response.
+type OpenAIEmbedResponse struct {
+	Data []OpenAIEmbedding `json:"data"`
+}
+
+// OpenAIEmbedding is a single entry of the OpenAIEmbedResponse data array.
+type OpenAIEmbedding struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
@@ -5,6 +5,54 @@ type IngestDataRequest struct {
 }
 
 type QueryTextRequest struct {
-	Query     string `json:"query"`
-	SessionID string `json:"sessionID,omitempty"`
+	Query     string           `json:"query"`
+	SessionID string           `json:"sessionID,omitempty"`
+	Retrieval RetrievalOptions `json:"retrieval,omitempty"`
+}
+
+// RetrievalOptions tunes how documents are retrieved for a single query.
+type RetrievalOptions struct {
+	// K is the number of chunks returned per retrieval. 0 means the default (3).
+	K int `json:"k,omitempty"`
+	// MMR re-selects the results with Maximal Marginal Relevance so they cover
+	// more distinct content. MMRLambda (0-1, default 0.5) trades relevance
+	// (1) against diversity (0).
+	MMR       *bool    `json:"mmr,omitempty"`
+	MMRLambda *float64 `json:"mmrLambda,omitempty"`
+	// VectorWeight and LexicalWeight scale the dense and BM25 result lists in
+	// reciprocal rank fusion. Nil means 1; 0 switches that retriever off.
+	VectorWeight  *float64 `json:"vectorWeight,omitempty"`
+	LexicalWeight *float64 `json:"lexicalWeight,omitempty"`
+	// Rerank toggles the reranking stage for this query. Nil means "on if a
+	// reranker is configured".
+	Rerank *bool `json:"rerank,omitempty"`
+	// Expand widens each result before it is sent to the model: "neighbors"
+	// adds the ExpandWindow chunks (default 1) on either side from the same
+	// file, "section" the enclosing markdown section. Overlapping results are
+	// merged into one document.
+	Expand       string `json:"expand,omitempty"`
+	ExpandWindow int    `json:"expandWindow,omitempty"`
+	// ExpandLinks adds, for the notes linked to or from the results by
+	// [[wikilinks]], the chunk of each that best matches the query.
+	ExpandLinks bool `json:"expandLinks,omitempty"`
+	// Filter scopes retrieval to a subset of the indexed chunks.
+	Filter RetrievalFilter `json:"filter,omitempty"`
+}
+
+// RetrievalFilter restricts retrieval by file, folder, tag, record field and modification date.
+// Every field is optional and all given fields must match.
+type RetrievalFilter struct {
+	// SourceFile is a glob matched against the file path (absolute or relative
+	// to the notes directory) or, without a separator, the file name.
+	SourceFile string `json:"source_file,omitempty"`
+	// Folder limits results to files under this folder (relative to the notes directory or absolute).
+	Folder string `json:"folder,omitempty"`
+	// Tags lists tags the chunk's file must all carry.
+	Tags []string `json:"tags,omitempty"`
+	// Fields maps structured-data field names (CSV columns, JSON or YAML
+	// keys, nested keys joined with dots) to the value a record must have.
+	Fields map[string]string `json:"fields,omitempty"`
+	// ModifiedAfter and ModifiedBefore are YYYY-MM-DD dates or RFC 3339 timestamps, inclusive.
+	ModifiedAfter  string `json:"modified_after,omitempty"`
+	ModifiedBefore string `json:"modified_before,omitempty"`
 }
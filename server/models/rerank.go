@@ -0,0 +1,13 @@
+package models
+
+// RerankRequest is the body sent to a text-embeddings-inference style /rerank endpoint.
+type RerankRequest struct {
+	Query string   `json:"query"`
+	Texts []string `json:"texts"`
+}
+
+// RerankResult is one entry of the /rerank response, scoring the text at Index.
+type RerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type InjestDataResponse struct {
 	Message string `json:"message"`
 	Error   string `json:"error,omitempty"`
@@ -11,3 +13,54 @@ type QueryRAGResponse struct {
 	Error      string           `json:"error,omitempty"`
 	SessionID  string           `json:"sessionID"`
 }
+
+// EmbeddingCacheStats reports how effective the on-disk embedding cache has been.
+type EmbeddingCacheStats struct {
+	Model   string  `json:"model"`
+	Entries int     `json:"entries"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// IndexJob is the indexing state of one file: "queued", "extracting",
+// "embedding", "indexed", "failed" or "skipped" (unchanged since last indexed).
+type IndexJob struct {
+	Path      string    `json:"path"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Chunks    int       `json:"chunks,omitempty"` // Set once the file is indexed
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ScanProgress reports on the most recent directory scan.
+type ScanProgress struct {
+	Running    bool       `json:"running"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// FilesFound counts the supported files walked so far, FilesQueued those
+	// that were new or changed, and FilesDone the queued files finished.
+	FilesFound  int `json:"filesFound"`
+	FilesQueued int `json:"filesQueued"`
+	FilesDone   int `json:"filesDone"`
+}
+
+// IndexStatus summarises the indexer for the GET /status endpoint.
+type IndexStatus struct {
+	// TotalFiles counts the files that are indexed and up to date.
+	TotalFiles  int            `json:"totalFiles"`
+	TotalChunks int            `json:"totalChunks"`
+	Failed      int            `json:"failedFiles"`
+	QueueDepth  int            `json:"queueDepth"`
+	States      map[string]int `json:"fileStates"`
+	LastScan    ScanProgress   `json:"lastScan"`
+	// EmbeddingCache is nil when the cache is disabled.
+	EmbeddingCache *EmbeddingCacheStats `json:"embeddingCache"`
+}
+
+// IndexJobsResponse is the structure for the response of the GET /index/jobs endpoint.
+type IndexJobsResponse struct {
+	Scan  ScanProgress `json:"scan"`
+	Count int          `json:"count"`
+	Jobs  []IndexJob   `json:"jobs"`
+}
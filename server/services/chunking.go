@@ -0,0 +1,272 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+// Default chunk sizing, in tokens. 256 tokens is roughly 1000 characters of
+// English prose.
+const (
+	defaultChunkSize    = 256
+	defaultChunkOverlap = 32
+	// defaultChunkChars is the default size of specs measured in characters.
+	defaultChunkChars = 1000
+)
+
+// Size units a ChunkerSpec can be measured in.
+const (
+	chunkUnitChars  = "chars"
+	chunkUnitTokens = "tokens"
+)
+
+// TextChunk is a piece of a file produced by a Chunker, before it is assigned
+// an ID.
+type TextChunk struct {
+	// Text is what gets embedded and indexed. It may carry a heading
+	// breadcrumb in front of the chunk body.
+	Text string
+	// Start and End are the rune offsets of the chunk body in the extracted
+	// text, or -1 when they could not be determined.
+	Start int
+	End   int
+	// SectionPath is the heading breadcrumb of the chunk, e.g. "Setup > Install".
+	SectionPath string
+	// Language, Symbol and the 1-based LineStart/LineEnd are set for source
+	// code chunks. Symbol lists the declarations the chunk covers.
+	Language  string
+	Symbol    string
+	LineStart int
+	LineEnd   int
+	// PageStart and PageEnd are the 1-based pages of a paged document (PDF)
+	// the chunk spans, or 0 for other files.
+	PageStart int
+	PageEnd   int
+	// Fields holds the field values of a structured-data record, keyed by
+	// field name.
+	Fields map[string]string
+}
+
+// Chunker splits the extracted text of a file into chunks.
+type Chunker interface {
+	// Chunk splits content, the extracted text of the file at path.
+	Chunk(path, content string) ([]TextChunk, error)
+	// Name is the strategy, e.g. "markdown".
+	Name() string
+	// Params describes the sizing, e.g. "size=256 overlap=32 unit=tokens tokenizer=wordpiece".
+	// Name and Params are stored with every chunk, and a change to either
+	// makes the indexer re-chunk the file.
+	Params() string
+}
+
+// ChunkerSpec configures one chunking strategy.
+type ChunkerSpec struct {
+	Strategy string `json:"strategy"`          // "recursive", "markdown", "code" or "records"
+	Size     int    `json:"size,omitempty"`    // Target chunk size (default 256 tokens or 1000 chars)
+	Overlap  int    `json:"overlap,omitempty"` // Overlap between consecutive chunks
+	Unit     string `json:"unit,omitempty"`    // "tokens" (default) or "chars"
+}
+
+// ChunkerConfig is the format of the CHUNKER_CONFIG file. Types is keyed by
+// file extension (".md"), MIME type ("application/pdf") or MIME wildcard
+// ("text/*"); files matching none of them use Default.
+type ChunkerConfig struct {
+	Default ChunkerSpec            `json:"default"`
+	Types   map[string]ChunkerSpec `json:"types"`
+}
+
+// chunkerStrategies builds a Chunker from a validated spec, keyed by strategy
+// name. lenFunc measures sizes in the spec's unit and params is what the
+// Chunker reports from Params.
+var chunkerStrategies = map[string]func(spec ChunkerSpec, lenFunc func(string) int, params string) Chunker{
+	"recursive": func(spec ChunkerSpec, lenFunc func(string) int, params string) Chunker {
+		return &recursiveChunker{spec: spec, lenFunc: lenFunc, params: params}
+	},
+	"markdown": func(spec ChunkerSpec, lenFunc func(string) int, params string) Chunker {
+		return &markdownChunker{spec: spec, lenFunc: lenFunc, params: params}
+	},
+	"code": func(spec ChunkerSpec, lenFunc func(string) int, params string) Chunker {
+		return &codeChunker{spec: spec, lenFunc: lenFunc, params: params}
+	},
+	"records": func(spec ChunkerSpec, lenFunc func(string) int, params string) Chunker {
+		return &recordChunker{spec: spec, lenFunc: lenFunc, params: params}
+	},
+}
+
+// defaultChunkerConfig reproduces the built-in behaviour: markdown-aware
+// chunking for notes and for documents whose extractors emit markdown
+// headings, declaration-aware chunking for source code, one chunk per record
+// for structured data and the recursive splitter for everything else.
+func defaultChunkerConfig() ChunkerConfig {
+	config := ChunkerConfig{
+		Default: ChunkerSpec{Strategy: "recursive", Size: defaultChunkSize, Overlap: defaultChunkOverlap, Unit: chunkUnitTokens},
+		Types:   make(map[string]ChunkerSpec),
+	}
+	for _, ext := range []string{".md", ".docx", ".html", ".htm", ".epub", ".rtf"} {
+		config.Types[ext] = ChunkerSpec{Strategy: "markdown", Size: defaultChunkSize, Overlap: defaultChunkOverlap, Unit: chunkUnitTokens}
+	}
+	for ext := range codeLanguages {
+		config.Types[ext] = ChunkerSpec{Strategy: "code", Size: defaultChunkSize, Unit: chunkUnitTokens}
+	}
+	for ext := range structuredExtensions {
+		config.Types[ext] = ChunkerSpec{Strategy: "records", Size: defaultChunkSize, Unit: chunkUnitTokens}
+	}
+	return config
+}
+
+// ChunkerRegistry picks the Chunker for a file by extension or MIME type.
+type ChunkerRegistry struct {
+	byType   map[string]Chunker
+	fallback Chunker
+}
+
+// NewChunkerRegistryFromEnv builds the registry from the JSON file named by
+// CHUNKER_CONFIG, layered over the built-in defaults. Without the variable
+// the defaults are used as they are. Token-sized specs are measured with tokenizer.
+func NewChunkerRegistryFromEnv(tokenizer Tokenizer) (*ChunkerRegistry, error) {
+	config := defaultChunkerConfig()
+	if path := os.Getenv("CHUNKER_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read chunker config %s: %w", path, err)
+		}
+		var custom ChunkerConfig
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("could not parse chunker config %s: %w", path, err)
+		}
+		if custom.Default.Strategy != "" {
+			config.Default = custom.Default
+		}
+		for key, spec := range custom.Types {
+			config.Types[key] = spec
+		}
+	}
+	return NewChunkerRegistry(config, tokenizer)
+}
+
+// NewChunkerRegistry validates config and builds a Chunker for every entry.
+func NewChunkerRegistry(config ChunkerConfig, tokenizer Tokenizer) (*ChunkerRegistry, error) {
+	fallback, err := newChunker(config.Default, tokenizer)
+	if err != nil {
+		return nil, fmt.Errorf("default chunker: %w", err)
+	}
+	r := &ChunkerRegistry{byType: make(map[string]Chunker), fallback: fallback}
+	for key, spec := range config.Types {
+		chunker, err := newChunker(spec, tokenizer)
+		if err != nil {
+			return nil, fmt.Errorf("chunker for %q: %w", key, err)
+		}
+		r.byType[strings.ToLower(key)] = chunker
+	}
+	return r, nil
+}
+
+// newChunker fills in defaults, validates spec and builds its Chunker.
+func newChunker(spec ChunkerSpec, tokenizer Tokenizer) (Chunker, error) {
+	build, ok := chunkerStrategies[spec.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown chunking strategy %q", spec.Strategy)
+	}
+	if spec.Unit == "" {
+		spec.Unit = chunkUnitTokens
+	}
+	var lenFunc func(string) int
+	switch spec.Unit {
+	case chunkUnitTokens:
+		lenFunc = tokenizer.Count
+		if spec.Size == 0 {
+			spec.Size = defaultChunkSize
+		}
+	case chunkUnitChars:
+		lenFunc = utf8.RuneCountInString
+		if spec.Size == 0 {
+			spec.Size = defaultChunkChars
+		}
+	default:
+		return nil, fmt.Errorf("unknown size unit %q (use %q or %q)", spec.Unit, chunkUnitTokens, chunkUnitChars)
+	}
+	if spec.Size < 0 || spec.Overlap < 0 || spec.Overlap >= spec.Size {
+		return nil, fmt.Errorf("invalid sizing size=%d overlap=%d", spec.Size, spec.Overlap)
+	}
+
+	params := fmt.Sprintf("size=%d overlap=%d unit=%s", spec.Size, spec.Overlap, spec.Unit)
+	if spec.Unit == chunkUnitTokens {
+		params += " tokenizer=" + tokenizer.Name()
+	}
+	return build(spec, lenFunc, params), nil
+}
+
+// ForFile returns the Chunker for path: an extension match wins over an
+// exact MIME type, which wins over a MIME wildcard.
+func (r *ChunkerRegistry) ForFile(path string) Chunker {
+	ext := strings.ToLower(filepath.Ext(path))
+	if chunker, ok := r.byType[ext]; ok {
+		return chunker
+	}
+	if mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil {
+		if chunker, ok := r.byType[mimeType]; ok {
+			return chunker
+		}
+		if major, _, ok := strings.Cut(mimeType, "/"); ok {
+			if chunker, ok := r.byType[major+"/*"]; ok {
+				return chunker
+			}
+		}
+	}
+	return r.fallback
+}
+
+// recursiveChunker uses langchaingo's recursive character splitter.
+type recursiveChunker struct {
+	spec    ChunkerSpec
+	lenFunc func(string) int
+	params  string
+}
+
+func (c *recursiveChunker) Chunk(_, content string) ([]TextChunk, error) {
+	return splitPlainText(content, c.spec.Size, c.spec.Overlap, c.lenFunc)
+}
+
+func (c *recursiveChunker) Name() string   { return "recursive" }
+func (c *recursiveChunker) Params() string { return c.params }
+
+// markdownChunker splits along the heading hierarchy; see splitMarkdown.
+type markdownChunker struct {
+	spec    ChunkerSpec
+	lenFunc func(string) int
+	params  string
+}
+
+func (c *markdownChunker) Chunk(_, content string) ([]TextChunk, error) {
+	return splitMarkdown(content, c.spec.Size, c.spec.Overlap, c.lenFunc)
+}
+
+func (c *markdownChunker) Name() string   { return "markdown" }
+func (c *markdownChunker) Params() string { return c.params }
+
+// splitPlainText splits content with langchaingo's recursive character
+// splitter and locates each piece in content. lenFunc measures chunk sizes.
+func splitPlainText(content string, chunkSize, chunkOverlap int, lenFunc func(string) int) ([]TextChunk, error) {
+	splitter := textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(chunkSize),
+		textsplitter.WithChunkOverlap(chunkOverlap),
+		textsplitter.WithLenFunc(lenFunc),
+	)
+	pieces, err := splitter.SplitText(content)
+	if err != nil {
+		return nil, err
+	}
+	offsets := locateChunks(content, pieces)
+	chunks := make([]TextChunk, len(pieces))
+	for i, piece := range pieces {
+		chunks[i] = TextChunk{Text: piece, Start: offsets[i][0], End: offsets[i][1]}
+	}
+	return chunks, nil
+}
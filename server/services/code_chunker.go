@@ -0,0 +1,386 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeLanguages maps source file extensions to the language stored in chunk
+// metadata. Every extension listed here is indexed.
+var codeLanguages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".java":  "java",
+	".kt":    "kotlin",
+	".cs":    "csharp",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".hpp":   "cpp",
+	".rs":    "rust",
+	".swift": "swift",
+	".rb":    "ruby",
+	".php":   "php",
+	".lua":   "lua",
+	".sh":    "shell",
+	".bash":  "shell",
+	".zsh":   "shell",
+	".sql":   "sql",
+}
+
+// indentLanguages delimit blocks by indentation rather than braces.
+var indentLanguages = map[string]bool{"python": true}
+
+// braceLanguages delimit blocks with { }.
+var braceLanguages = map[string]bool{
+	"go": true, "javascript": true, "typescript": true, "java": true, "kotlin": true,
+	"csharp": true, "c": true, "cpp": true, "rust": true, "swift": true, "php": true,
+}
+
+// symbolRegex finds the name a top-level unit declares in most languages.
+var symbolRegex = regexp.MustCompile(`\b(?:func|function|def|class|struct|interface|enum|trait|impl|fn|type|module|object|record|namespace)\s*\*?\s+([A-Za-z_$][\w$]*)`)
+
+// assignedSymbolRegex catches `const name = ...` style declarations.
+var assignedSymbolRegex = regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:const|let|var|local)\s+([A-Za-z_$][\w$]*)\s*=`)
+
+// codeLanguage returns the language of a source file, or "" if it is not code.
+func codeLanguage(path string) string {
+	return codeLanguages[strings.ToLower(filepath.Ext(path))]
+}
+
+// codeUnit is a top-level declaration spanning lines [startLine, endLine]
+// (0-based, inclusive).
+type codeUnit struct {
+	startLine, endLine int
+	symbol             string
+}
+
+// codeChunker splits source files at function and class boundaries: Go files
+// through go/ast, other languages with a brace/indentation heuristic. Small
+// neighbouring declarations are packed together up to the chunk size, and
+// declarations larger than it are split on line boundaries.
+type codeChunker struct {
+	spec    ChunkerSpec
+	lenFunc func(string) int
+	params  string
+}
+
+func (c *codeChunker) Name() string   { return "code" }
+func (c *codeChunker) Params() string { return c.params }
+
+// Chunk splits content using the language implied by path.
+func (c *codeChunker) Chunk(path, content string) ([]TextChunk, error) {
+	language := codeLanguage(path)
+	lines := strings.Split(content, "\n")
+
+	var units []codeUnit
+	if language == "go" {
+		units = goUnits(path, content)
+	}
+	if units == nil {
+		units = heuristicUnits(lines, language)
+	}
+	return c.pack(lines, units, language), nil
+}
+
+// pack merges consecutive units into chunks of at most spec.Size and splits
+// oversized units by lines.
+func (c *codeChunker) pack(lines []string, units []codeUnit, language string) []TextChunk {
+	// lineStart[i] is the rune offset where line i begins.
+	lineStart := make([]int, len(lines)+1)
+	for i, line := range lines {
+		lineStart[i+1] = lineStart[i] + utf8.RuneCountInString(line) + 1
+	}
+	text := func(from, to int) string { return strings.Join(lines[from:to+1], "\n") }
+
+	var chunks []TextChunk
+	emit := func(from, to int, symbols []string) {
+		body := text(from, to)
+		if strings.TrimSpace(body) == "" {
+			return
+		}
+		chunks = append(chunks, TextChunk{
+			Text:      body,
+			Start:     lineStart[from],
+			End:       lineStart[from] + utf8.RuneCountInString(body),
+			Language:  language,
+			Symbol:    strings.Join(symbols, ", "),
+			LineStart: from + 1,
+			LineEnd:   to + 1,
+		})
+	}
+
+	pendingFrom, pendingTo := -1, -1
+	var pendingSymbols []string
+	flush := func() {
+		if pendingFrom >= 0 {
+			emit(pendingFrom, pendingTo, pendingSymbols)
+		}
+		pendingFrom, pendingTo, pendingSymbols = -1, -1, nil
+	}
+	addSymbol := func(symbols []string, symbol string) []string {
+		if symbol == "" {
+			return symbols
+		}
+		return append(symbols, symbol)
+	}
+
+	for _, u := range units {
+		if pendingFrom >= 0 && c.lenFunc(text(pendingFrom, u.endLine)) <= c.spec.Size {
+			pendingTo = u.endLine
+			pendingSymbols = addSymbol(pendingSymbols, u.symbol)
+			continue
+		}
+		flush()
+		if c.lenFunc(text(u.startLine, u.endLine)) <= c.spec.Size {
+			pendingFrom, pendingTo = u.startLine, u.endLine
+			pendingSymbols = addSymbol(nil, u.symbol)
+			continue
+		}
+		// An oversized declaration: cut it into runs of whole lines.
+		from := u.startLine
+		for line := u.startLine; line <= u.endLine; line++ {
+			if line > from && c.lenFunc(text(from, line)) > c.spec.Size {
+				emit(from, line-1, addSymbol(nil, u.symbol))
+				from = line
+			}
+		}
+		emit(from, u.endLine, addSymbol(nil, u.symbol))
+	}
+	flush()
+	return chunks
+}
+
+// goUnits parses a Go file and returns one unit per top-level declaration,
+// with doc comments attached and the package clause and imports as the first
+// unit. It returns nil if the file does not parse.
+func goUnits(path, content string) []codeUnit {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	line := func(pos token.Pos) int { return fset.Position(pos).Line - 1 }
+
+	var units []codeUnit
+	next := 0 // first line not yet covered by a unit
+	for _, decl := range file.Decls {
+		start := decl.Pos()
+		var symbol string
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			symbol = d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol = receiverName(d.Recv.List[0].Type) + "." + symbol
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			if d.Tok == token.IMPORT {
+				// Imports join the package clause in the header unit.
+				continue
+			}
+			symbol = genDeclSymbol(d)
+		}
+		from := line(start)
+		if len(units) == 0 && from > next {
+			// The package clause, imports and file comments before the first declaration.
+			units = append(units, codeUnit{startLine: 0, endLine: from - 1, symbol: "package " + file.Name.Name})
+			next = from
+		}
+		// Free-floating comments between declarations stick to the next one.
+		units = append(units, codeUnit{startLine: min(next, from), endLine: line(decl.End()), symbol: symbol})
+		next = line(decl.End()) + 1
+	}
+	if len(units) == 0 {
+		total := strings.Count(content, "\n")
+		return []codeUnit{{startLine: 0, endLine: total, symbol: "package " + file.Name.Name}}
+	}
+	if total := strings.Count(content, "\n"); next <= total {
+		units[len(units)-1].endLine = total
+	}
+	return units
+}
+
+// receiverName returns the type name of a method receiver, without pointer
+// or type parameters.
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// genDeclSymbol lists the names declared by a type, var or const declaration.
+func genDeclSymbol(d *ast.GenDecl) string {
+	var names []string
+	for _, spec := range d.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, n := range s.Names {
+				names = append(names, n.Name)
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// heuristicUnits finds top-level declarations without a parser. A unit starts
+// at a non-blank line at nesting depth zero (brace depth for brace languages,
+// indentation otherwise); comments, decorators and attributes directly above
+// it are pulled into the unit.
+func heuristicUnits(lines []string, language string) []codeUnit {
+	var starts []int
+	depth := 0
+	inBlockComment := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		topLevel := false
+		switch {
+		case trimmed == "":
+		case braceLanguages[language] || language == "":
+			// Parentheses and brackets count too, so multi-line signatures
+			// and literals don't look like new declarations.
+			topLevel = depth == 0 && !inBlockComment && !strings.ContainsAny(trimmed[:1], "})]")
+			var delta int
+			delta, inBlockComment = braceDelta(line, inBlockComment)
+			depth = max(depth+delta, 0)
+		case indentLanguages[language]:
+			topLevel = line[0] != ' ' && line[0] != '\t'
+		default:
+			// Blank-line separated blocks starting at column zero.
+			topLevel = line[0] != ' ' && line[0] != '\t' && (i == 0 || strings.TrimSpace(lines[i-1]) == "")
+		}
+		if topLevel && !continuesPrevious(lines, i, language) {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) == 0 || starts[0] != 0 {
+		starts = append([]int{0}, starts...)
+	}
+
+	units := make([]codeUnit, len(starts))
+	for i, start := range starts {
+		end := len(lines) - 1
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+		units[i] = codeUnit{startLine: start, endLine: end, symbol: findSymbol(lines[start : end+1])}
+	}
+	return units
+}
+
+// continuesPrevious reports whether top-level line i belongs with the lines
+// above it: a declaration directly preceded by comments or decorators, or a
+// closing line like Python's "else:" at column zero.
+func continuesPrevious(lines []string, i int, language string) bool {
+	if i == 0 {
+		return false
+	}
+	prev := strings.TrimSpace(lines[i-1])
+	if prev == "" {
+		return false
+	}
+	if isCommentLine(prev) || strings.HasPrefix(prev, "@") || strings.HasPrefix(prev, "#[") || strings.HasPrefix(prev, "[") {
+		return true
+	}
+	trimmed := strings.TrimSpace(lines[i])
+	if indentLanguages[language] {
+		for _, kw := range []string{"else", "elif", "except", "finally"} {
+			if strings.HasPrefix(trimmed, kw) {
+				return true
+			}
+		}
+		// Top-level statements that are not definitions group with their neighbours.
+		return !strings.HasPrefix(trimmed, "def ") && !strings.HasPrefix(trimmed, "async def ") &&
+			!strings.HasPrefix(trimmed, "class ") && !strings.HasPrefix(trimmed, "@") && !isCommentLine(trimmed)
+	}
+	return false
+}
+
+// isCommentLine reports whether a trimmed line is a comment in a common syntax.
+func isCommentLine(trimmed string) bool {
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", "\"\"\""} {
+		if strings.HasPrefix(trimmed, prefix) && !strings.HasPrefix(trimmed, "#[") && !strings.HasPrefix(trimmed, "#include") {
+			return true
+		}
+	}
+	return false
+}
+
+// braceDelta returns how much line changes the nesting depth of braces,
+// parentheses and brackets, ignoring those in string literals and comments,
+// and whether a block comment is still open at its end.
+func braceDelta(line string, inBlockComment bool) (int, bool) {
+	delta := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case inBlockComment:
+			if ch == '*' && i+1 < len(line) && line[i+1] == '/' {
+				inBlockComment = false
+				i++
+			}
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '/' && i+1 < len(line) && line[i+1] == '/':
+			return delta, false
+		case ch == '/' && i+1 < len(line) && line[i+1] == '*':
+			inBlockComment = true
+			i++
+		case ch == '"' || ch == '\'' || ch == '`':
+			quote = ch
+		case ch == '{' || ch == '(' || ch == '[':
+			delta++
+		case ch == '}' || ch == ')' || ch == ']':
+			delta--
+		}
+	}
+	return delta, inBlockComment
+}
+
+// findSymbol returns the first declared name in a unit's lines.
+func findSymbol(lines []string) string {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || isCommentLine(trimmed) {
+			continue
+		}
+		if m := symbolRegex.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+		if m := assignedSymbolRegex.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
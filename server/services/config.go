@@ -0,0 +1,30 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// envOrDefault returns the value of the environment variable key, or fallback when it is unset.
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envIntOrDefault parses a positive integer from the environment, falling back
+// (with a warning) when the variable is unset or invalid.
+func envIntOrDefault(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(v)
+	if err != nil || parsed <= 0 {
+		log.Printf("WARN: Invalid %s=%q, using default %d", key, v, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github/itish2003/rag/models"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// Context expansion modes for RetrievalOptions.Expand.
+const (
+	ExpandNeighbors = "neighbors"
+	ExpandSection   = "section"
+)
+
+// maxSectionRunes caps how large an enclosing markdown section may be before
+// section expansion falls back to neighbouring chunks.
+const maxSectionRunes = 6000
+
+// expansionSpan is a contiguous region of one file covering one or more hits.
+type expansionSpan struct {
+	file    string
+	lo, hi  int   // inclusive chunk numbers, or rune offsets [lo, hi) for sections
+	hits    []int // indices into the original docs, best-ranked first
+	section bool  // true when lo/hi are rune offsets of a markdown section
+}
+
+// expandDocuments widens each retrieved chunk with its neighbouring chunks or
+// its enclosing markdown section, then merges spans that overlap so the same
+// text is never sent twice. The result keeps the order of the best hit in
+// each merged span. Docs that cannot be expanded are returned unchanged.
+func (r *ragServiceImpl) expandDocuments(c context.Context, docs []models.SourceDocument, mode string, window int) []models.SourceDocument {
+	if window <= 0 {
+		window = 1
+	}
+
+	var spans []*expansionSpan
+	passthrough := make(map[int]bool)
+	fileTexts := make(map[string][]rune)
+	for i, doc := range docs {
+		if doc.SourceFile == "" {
+			passthrough[i] = true
+			continue
+		}
+		if mode == ExpandSection {
+			if lo, hi, ok := r.sectionBounds(doc, fileTexts); ok {
+				spans = append(spans, &expansionSpan{file: doc.SourceFile, lo: lo, hi: hi, hits: []int{i}, section: true})
+				continue
+			}
+		}
+		spans = append(spans, &expansionSpan{
+			file: doc.SourceFile,
+			lo:   max(doc.ChunkNum-window, 0),
+			hi:   doc.ChunkNum + window,
+			hits: []int{i},
+		})
+	}
+	merged := mergeSpans(spans)
+
+	// Build the expanded document for each merged span, keyed by its best hit.
+	expanded := make(map[int]models.SourceDocument)
+	for _, span := range merged {
+		best := span.hits[0]
+		var doc models.SourceDocument
+		var err error
+		if span.section {
+			doc, err = sectionDocument(docs, span, fileTexts[span.file])
+		} else {
+			doc, err = r.neighborDocument(c, docs, span)
+		}
+		if err != nil {
+			log.Printf("WARN: Could not expand context for %s: %v", span.file, err)
+			for _, h := range span.hits {
+				passthrough[h] = true
+			}
+			continue
+		}
+		expanded[best] = doc
+	}
+
+	result := make([]models.SourceDocument, 0, len(docs))
+	for i, doc := range docs {
+		if passthrough[i] {
+			result = append(result, doc)
+		} else if exp, ok := expanded[i]; ok {
+			result = append(result, exp)
+		}
+	}
+	return result
+}
+
+// mergeSpans merges overlapping or adjacent spans of the same file and kind.
+// Hits in the merged span stay in rank order (lowest doc index first).
+func mergeSpans(spans []*expansionSpan) []*expansionSpan {
+	sort.SliceStable(spans, func(a, b int) bool {
+		if spans[a].file != spans[b].file {
+			return spans[a].file < spans[b].file
+		}
+		if spans[a].section != spans[b].section {
+			return !spans[a].section
+		}
+		return spans[a].lo < spans[b].lo
+	})
+
+	var merged []*expansionSpan
+	for _, s := range spans {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			// Chunk ranges are inclusive, so adjacent chunk numbers merge too.
+			limit := last.hi
+			if !s.section {
+				limit++
+			}
+			if last.file == s.file && last.section == s.section && s.lo <= limit {
+				last.hi = max(last.hi, s.hi)
+				last.hits = append(last.hits, s.hits...)
+				sort.Ints(last.hits)
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// neighborDocument loads chunks lo..hi of the span's file and stitches them
+// into one document, dropping the overlap between consecutive chunks and the
+// heading breadcrumbs markdown chunks carry.
+func (r *ragServiceImpl) neighborDocument(c context.Context, docs []models.SourceDocument, span *expansionSpan) (models.SourceDocument, error) {
+	nums := make([]int, 0, span.hi-span.lo+1)
+	for n := span.lo; n <= span.hi; n++ {
+		nums = append(nums, n)
+	}
+	results, err := r.collection.Get(c,
+		chromago.WithWhereGet(chromago.And(
+			chromago.EqString("source_file", span.file),
+			chromago.InInt("chunk_num", nums...),
+		)),
+		chromago.WithIncludeGet(chromago.IncludeDocuments, chromago.IncludeMetadatas),
+	)
+	if err != nil {
+		return models.SourceDocument{}, err
+	}
+
+	type neighbor struct {
+		num, start, end    int
+		pageStart, pageEnd int
+		text, section      string
+	}
+	var chunks []neighbor
+	documents := results.GetDocuments()
+	metadatas := results.GetMetadatas()
+	for i := range results.GetIDs() {
+		var metadata chromago.DocumentMetadata
+		if i < len(metadatas) {
+			metadata = metadatas[i]
+		}
+		meta := metadataToMap(metadata)
+		section, _ := meta["section_path"].(string)
+		chunks = append(chunks, neighbor{
+			num:       metadataInt(meta, "chunk_num", 0),
+			start:     metadataInt(meta, "char_start", -1),
+			end:       metadataInt(meta, "char_end", -1),
+			pageStart: metadataInt(meta, "page_start", 0),
+			pageEnd:   metadataInt(meta, "page_end", 0),
+			text:      chunkBody(documents[i].ContentString(), section),
+			section:   section,
+		})
+	}
+	if len(chunks) == 0 {
+		return models.SourceDocument{}, fmt.Errorf("no chunks found in range %d-%d", span.lo, span.hi)
+	}
+	sort.Slice(chunks, func(a, b int) bool { return chunks[a].num < chunks[b].num })
+
+	var sb strings.Builder
+	sb.WriteString(chunks[0].text)
+	prevEnd := chunks[0].end
+	for _, ch := range chunks[1:] {
+		text := []rune(ch.text)
+		if ch.start >= 0 && prevEnd >= 0 {
+			overlap := prevEnd - ch.start
+			if overlap >= len(text) {
+				prevEnd = max(prevEnd, ch.end)
+				continue
+			}
+			if overlap > 0 {
+				text = text[overlap:]
+			} else {
+				sb.WriteString("\n")
+			}
+		} else {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(string(text))
+		prevEnd = ch.end
+	}
+
+	// Stitch bodies only, then restore the breadcrumb of the first chunk.
+	doc := expandedFrom(docs, span, ExpandNeighbors, withBreadcrumb(chunks[0].section, sb.String()))
+	doc.CharStart = chunks[0].start
+	doc.CharEnd = chunks[len(chunks)-1].end
+	if doc.CharStart < 0 || doc.CharEnd < 0 {
+		doc.CharStart, doc.CharEnd = -1, -1
+	}
+	for _, ch := range chunks {
+		if ch.pageStart > 0 && (doc.PageStart == 0 || ch.pageStart < doc.PageStart) {
+			doc.PageStart = ch.pageStart
+		}
+		doc.PageEnd = max(doc.PageEnd, ch.pageEnd)
+	}
+	doc.Citation = citation(doc.SourceFile, doc.PageStart, doc.PageEnd)
+	doc.Metadata["expanded_chunk_start"] = chunks[0].num
+	doc.Metadata["expanded_chunk_end"] = chunks[len(chunks)-1].num
+	return doc, nil
+}
+
+// sectionBounds finds the rune span of the markdown section enclosing doc.
+// It applies to notes and to any file that was split by the markdown chunker
+// (whose extracted text has markdown headings). It re-extracts the file
+// (caching it in fileTexts) and only succeeds if the file still has the hash
+// the chunk was indexed from.
+func (r *ragServiceImpl) sectionBounds(doc models.SourceDocument, fileTexts map[string][]rune) (int, int, bool) {
+	isMarkdown := strings.EqualFold(filepath.Ext(doc.SourceFile), ".md") || doc.Metadata["chunker"] == "markdown"
+	if !isMarkdown || doc.CharStart < 0 {
+		return 0, 0, false
+	}
+	text, ok := fileTexts[doc.SourceFile]
+	if !ok {
+		if hash, _ := doc.Metadata["file_hash"].(string); hash != "" {
+			if current, err := calculateFileHash(doc.SourceFile); err != nil || current != hash {
+				return 0, 0, false
+			}
+		}
+		content, err := ExtractTextFromFile(doc.SourceFile)
+		if err != nil {
+			return 0, 0, false
+		}
+		text = []rune(content)
+		fileTexts[doc.SourceFile] = text
+	}
+	if doc.CharEnd > len(text) {
+		return 0, 0, false
+	}
+
+	lo, hi := enclosingSection(text, doc.CharStart)
+	if _, bodyStart, ok := splitFrontmatter(string(text)); ok && lo < bodyStart {
+		lo = bodyStart // a section never includes the frontmatter
+	}
+	if hi-lo > maxSectionRunes || hi < doc.CharEnd {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// enclosingSection returns the rune span [lo, hi) of the section containing
+// offset: from the closest preceding heading to the next heading of the same
+// or a higher level. Headings inside fenced code blocks are ignored.
+func enclosingSection(text []rune, offset int) (int, int) {
+	type heading struct{ pos, level int }
+	var headings []heading
+	inFence := false
+	pos := 0
+	for _, line := range strings.SplitAfter(string(text), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		} else if !inFence {
+			if level := headingLevel(line); level > 0 {
+				headings = append(headings, heading{pos: pos, level: level})
+			}
+		}
+		pos += len([]rune(line))
+	}
+
+	lo, level := 0, 0
+	for _, h := range headings {
+		if h.pos > offset {
+			break
+		}
+		lo, level = h.pos, h.level
+	}
+	hi := len(text)
+	for _, h := range headings {
+		if h.pos > lo && (level == 0 || h.level <= level) {
+			hi = h.pos
+			break
+		}
+	}
+	return lo, hi
+}
+
+// headingLevel returns the ATX heading level of a markdown line, or 0.
+func headingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(line) || (line[level] != ' ' && line[level] != '\t') {
+		return 0
+	}
+	return level
+}
+
+// sectionDocument cuts the merged section span out of the file text.
+func sectionDocument(docs []models.SourceDocument, span *expansionSpan, text []rune) (models.SourceDocument, error) {
+	if span.hi > len(text) {
+		return models.SourceDocument{}, fmt.Errorf("section %d-%d is outside the file", span.lo, span.hi)
+	}
+	doc := expandedFrom(docs, span, ExpandSection, strings.TrimSpace(string(text[span.lo:span.hi])))
+	doc.CharStart, doc.CharEnd = span.lo, span.hi
+	return doc, nil
+}
+
+// expandedFrom builds the merged document from the span's best hit, recording
+// every chunk it absorbed.
+func expandedFrom(docs []models.SourceDocument, span *expansionSpan, mode, text string) models.SourceDocument {
+	best := docs[span.hits[0]]
+	doc := best
+	doc.Text = text
+	doc.Metadata = make(map[string]interface{}, len(best.Metadata)+3)
+	for k, v := range best.Metadata {
+		doc.Metadata[k] = v
+	}
+	ids := make([]string, len(span.hits))
+	for i, h := range span.hits {
+		ids[i] = docs[h].ID
+		doc.Score = max(doc.Score, docs[h].Score)
+	}
+	doc.Metadata["expansion"] = mode
+	doc.Metadata["merged_ids"] = strings.Join(ids, ",")
+	return doc
+}
+
+// linkExpansion is the "expansion" metadata value of documents added from linked notes.
+const linkExpansion = "links"
+
+// expandLinkedNotes appends, for notes linked to or from the notes among docs,
+// the chunk of each that best matches query, up to limit extra documents.
+// Linked notes already in docs are skipped and the retrieval filter still
+// applies. On failure docs are returned unchanged.
+func (r *ragServiceImpl) expandLinkedNotes(c context.Context, query string, docs []models.SourceDocument, filter *resolvedFilter, limit int) []models.SourceDocument {
+	if r.links == nil || limit <= 0 {
+		return docs
+	}
+	present := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		present[doc.SourceFile] = true
+	}
+	linkedFrom := make(map[string]string) // linked note -> result it was reached from
+	var linked []string
+	for _, doc := range docs {
+		if !isNote(doc.SourceFile) {
+			continue
+		}
+		outgoing, _ := r.links.Links(doc.SourceFile)
+		for _, note := range append(outgoing, r.links.Backlinks(doc.SourceFile)...) {
+			if present[note] || linkedFrom[note] != "" || (filter.files != nil && !filter.files[note]) {
+				continue
+			}
+			linkedFrom[note] = doc.SourceFile
+			linked = append(linked, note)
+		}
+	}
+	if len(linked) == 0 {
+		return docs
+	}
+
+	where := whereAll(append(filter.clauses(), chromago.InString("source_file", linked...)))
+	hits, err := r.vectorSearch(c, query, limit*4, where)
+	if err != nil {
+		log.Printf("WARN: Link expansion failed, keeping results unexpanded: %v", err)
+		return docs
+	}
+	added := 0
+	for _, hit := range hits {
+		file, _ := hit.Metadata["source_file"].(string)
+		if present[file] || added == limit {
+			continue
+		}
+		present[file] = true
+		added++
+		hit.Metadata["expansion"] = linkExpansion
+		hit.Metadata["linked_from"] = linkedFrom[file]
+		docs = append(docs, newSourceDocument(hit.ID, hit.Text, hit.Metadata, hit.Distance, 0))
+	}
+	log.Printf("SERVICE-HELPER: Link expansion added %d of %d linked notes", added, len(linked))
+	return docs
+}
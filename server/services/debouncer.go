@@ -0,0 +1,56 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// debouncer runs a callback for a key once events for that key have been
+// quiet for a delay, so a burst of events (an editor's write, rename and
+// chmod on save) is handled once, after the last of them.
+type debouncer struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	timers map[string]*time.Timer
+	fire   func(key string)
+}
+
+func newDebouncer(delay time.Duration, fire func(key string)) *debouncer {
+	return &debouncer{
+		delay:  delay,
+		timers: make(map[string]*time.Timer),
+		fire:   fire,
+	}
+}
+
+// Trigger (re)starts the delay for key.
+func (d *debouncer) Trigger(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.timers[key]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		// A timer stopped too late to cancel still runs; only the latest fires.
+		if d.timers[key] != t {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.timers, key)
+		d.mu.Unlock()
+		d.fire(key)
+	})
+	d.timers[key] = t
+}
+
+// Stop cancels every pending callback.
+func (d *debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, t := range d.timers {
+		t.Stop()
+		delete(d.timers, key)
+	}
+}
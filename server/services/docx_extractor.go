@@ -0,0 +1,184 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// docxHeadingStyleRegex matches Word's built-in heading style IDs
+// ("Heading1", "heading 2").
+var docxHeadingStyleRegex = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+// extractTextFromDOCX reads the body of a Word document. Paragraphs with a
+// heading style or outline level become markdown "#" lines, list paragraphs
+// become "- " items and tables become pipe tables.
+func extractTextFromDOCX(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		return parseDOCXBody(rc)
+	}
+	return "", fmt.Errorf("%s has no word/document.xml", path)
+}
+
+// docxParagraph accumulates one w:p element.
+type docxParagraph struct {
+	text    strings.Builder
+	heading int // 0 for body text
+	list    bool
+}
+
+// parseDOCXBody streams WordprocessingML and renders it as text.
+func parseDOCXBody(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+	var out strings.Builder
+	var para *docxParagraph
+	tableDepth := 0
+	var row []string
+	var cell strings.Builder
+	rowsInTable := 0
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not parse document.xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para = &docxParagraph{}
+			case "pStyle":
+				if para != nil {
+					style := docxAttr(t, "val")
+					if strings.EqualFold(style, "Title") {
+						para.heading = 1
+					} else if m := docxHeadingStyleRegex.FindStringSubmatch(style); m != nil {
+						para.heading, _ = strconv.Atoi(m[1])
+					}
+				}
+			case "outlineLvl":
+				if para != nil && para.heading == 0 {
+					if lvl, err := strconv.Atoi(docxAttr(t, "val")); err == nil && lvl < 9 {
+						para.heading = lvl + 1
+					}
+				}
+			case "numPr":
+				if para != nil {
+					para.list = true
+				}
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return "", err
+				}
+				if para != nil {
+					para.text.WriteString(text)
+				}
+			case "tab":
+				if para != nil {
+					para.text.WriteString("\t")
+				}
+			case "br", "cr":
+				if para != nil {
+					para.text.WriteString("\n")
+				}
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					rowsInTable = 0
+					if s := out.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+						out.WriteString("\n") // a table after a list item
+					}
+				}
+			case "tr":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell.Reset()
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				if para == nil {
+					continue
+				}
+				p := para
+				para = nil
+				text := strings.TrimSpace(p.text.String())
+				if text == "" {
+					continue
+				}
+				if tableDepth > 0 {
+					// Paragraphs inside a cell (or nested table) flatten into the cell.
+					if cell.Len() > 0 {
+						cell.WriteString(" ")
+					}
+					cell.WriteString(strings.Join(strings.Fields(text), " "))
+					continue
+				}
+				switch {
+				case p.heading > 0:
+					out.WriteString(strings.Repeat("#", p.heading) + " " + strings.Join(strings.Fields(text), " ") + "\n\n")
+				case p.list:
+					out.WriteString("- " + text + "\n")
+				default:
+					out.WriteString(text + "\n\n")
+				}
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, strings.ReplaceAll(cell.String(), "|", "\\|"))
+				}
+			case "tr":
+				if tableDepth == 1 && len(row) > 0 {
+					out.WriteString("| " + strings.Join(row, " | ") + " |\n")
+					if rowsInTable == 0 {
+						out.WriteString(strings.Repeat("| --- ", len(row)) + "|\n")
+					}
+					rowsInTable++
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					out.WriteString("\n")
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// docxAttr returns the value of an attribute by local name (w:val and friends).
+func docxAttr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github/itish2003/rag/models"
+)
+
+// Embedder turns text into vectors. Both indexing and retrieval go through it,
+// so the same model is always used on both sides of the similarity search.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// EmbedBatch embeds several texts at once, returning vectors in input order.
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+	// ModelName identifies the model producing the vectors.
+	ModelName() string
+}
+
+// NewEmbedderFromEnv picks an Embedder implementation based on EMBEDDER_PROVIDER.
+// Supported providers are "ollama" (default), "openai" and "hashing".
+func NewEmbedderFromEnv(httpClient *http.Client) (Embedder, error) {
+	provider := strings.ToLower(os.Getenv("EMBEDDER_PROVIDER"))
+	model := os.Getenv("EMBEDDING_MODEL")
+
+	switch provider {
+	case "", "ollama":
+		if model == "" {
+			model = "nomic-embed-text:v1.5"
+		}
+		return NewOllamaEmbedder(httpClient, envOrDefault("OLLAMA_BASE_URL", "http://localhost:11434"), model), nil
+	case "openai":
+		if model == "" {
+			model = "text-embedding-3-small"
+		}
+		return NewOpenAIEmbedder(httpClient, envOrDefault("OPENAI_BASE_URL", "https://api.openai.com"), os.Getenv("OPENAI_API_KEY"), model), nil
+	case "hashing":
+		dim := 768
+		if v := os.Getenv("HASH_EMBEDDING_DIM"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid HASH_EMBEDDING_DIM %q", v)
+			}
+			dim = parsed
+		}
+		return NewHashingEmbedder(dim), nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDER_PROVIDER %q", provider)
+	}
+}
+
+// ollamaEmbedder calls a local Ollama instance.
+type ollamaEmbedder struct {
+	httpClient *http.Client
+	baseURL    string
+	model      string
+	// legacyAPI is set once the server turns out not to support /api/embed,
+	// after which we fall back to one /api/embeddings call per text.
+	legacyAPI atomic.Bool
+}
+
+// NewOllamaEmbedder creates an Embedder backed by Ollama's embeddings API.
+func NewOllamaEmbedder(httpClient *http.Client, baseURL, model string) Embedder {
+	return &ollamaEmbedder{
+		httpClient: httpClient,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		model:      model,
+	}
+}
+
+func (e *ollamaEmbedder) ModelName() string {
+	return e.model
+}
+
+// Embed generates an embedding using Ollama.
+func (e *ollamaEmbedder) Embed(c context.Context, textToEmbed string) ([]float32, error) {
+	vectors, err := e.EmbedBatch(c, []string{textToEmbed})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch embeds all texts with a single /api/embed call when the server supports it.
+func (e *ollamaEmbedder) EmbedBatch(c context.Context, texts []string) ([][]float32, error) {
+	if !e.legacyAPI.Load() {
+		var ollamaResp models.OllamaEmbedBatchResponse
+		err := postJSON(c, e.httpClient, e.baseURL+"/api/embed", "", models.OllamaEmbedBatchRequest{
+			Model: e.model,
+			Input: texts,
+		}, &ollamaResp)
+		if err == nil {
+			if len(ollamaResp.Embeddings) != len(texts) {
+				return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(ollamaResp.Embeddings), len(texts))
+			}
+			return ollamaResp.Embeddings, nil
+		}
+		// Servers without /api/embed answer 404 "page not found"; a 404 that
+		// names the model means it is not pulled, which the legacy API won't fix.
+		var statusErr *httpStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || strings.Contains(strings.ToLower(statusErr.Body), "model") {
+			return nil, fmt.Errorf("ollama embed request failed: %w", err)
+		}
+		log.Printf("WARN: Ollama at %s does not support /api/embed, falling back to /api/embeddings", e.baseURL)
+		e.legacyAPI.Store(true)
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		var ollamaResp models.OllamaEmbedResponse
+		err := postJSON(c, e.httpClient, e.baseURL+"/api/embeddings", "", models.OllamaEmbedRequest{
+			Model:  e.model,
+			Prompt: text,
+		}, &ollamaResp)
+		if err != nil {
+			return nil, fmt.Errorf("ollama embeddings request failed: %w", err)
+		}
+		vectors = append(vectors, ollamaResp.Embedding)
+	}
+	return vectors, nil
+}
+
+// openAIEmbedder calls any server implementing the OpenAI /v1/embeddings API
+// (OpenAI itself, LM Studio, vLLM, llama.cpp server, ...).
+type openAIEmbedder struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+}
+
+// NewOpenAIEmbedder creates an Embedder backed by an OpenAI-compatible embeddings API.
+func NewOpenAIEmbedder(httpClient *http.Client, baseURL, apiKey, model string) Embedder {
+	return &openAIEmbedder{
+		httpClient: httpClient,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+	}
+}
+
+func (e *openAIEmbedder) ModelName() string {
+	return e.model
+}
+
+// Embed generates an embedding using the /v1/embeddings endpoint.
+func (e *openAIEmbedder) Embed(c context.Context, textToEmbed string) ([]float32, error) {
+	vectors, err := e.EmbedBatch(c, []string{textToEmbed})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch sends all texts as the input array of one /v1/embeddings request.
+func (e *openAIEmbedder) EmbedBatch(c context.Context, texts []string) ([][]float32, error) {
+	var embedResp models.OpenAIEmbedResponse
+	err := postJSON(c, e.httpClient, e.baseURL+"/v1/embeddings", e.apiKey, models.OpenAIEmbedRequest{
+		Model: e.model,
+		Input: texts,
+	}, &embedResp)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	if len(embedResp.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings api returned %d embeddings for %d inputs", len(embedResp.Data), len(texts))
+	}
+
+	// The API does not guarantee ordering, so place each vector by its index.
+	vectors := make([][]float32, len(texts))
+	for _, d := range embedResp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings api returned out-of-range index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// hashingEmbedder is a deterministic, model-free embedder based on the hashing
+// trick. It needs no network access, which makes it useful for offline tests.
+type hashingEmbedder struct {
+	dim int
+}
+
+// NewHashingEmbedder creates a deterministic Embedder producing vectors of size dim.
+func NewHashingEmbedder(dim int) Embedder {
+	return &hashingEmbedder{dim: dim}
+}
+
+func (e *hashingEmbedder) ModelName() string {
+	return fmt.Sprintf("hashing-%d", e.dim)
+}
+
+// Embed hashes each lowercased token into a bucket and L2-normalises the result.
+func (e *hashingEmbedder) Embed(_ context.Context, textToEmbed string) ([]float32, error) {
+	vec := make([]float32, e.dim)
+	tokens := strings.FieldsFunc(strings.ToLower(textToEmbed), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, token := range tokens {
+		sum := sha256.Sum256([]byte(token))
+		bucket := binary.BigEndian.Uint64(sum[:8]) % uint64(e.dim)
+		// Use another hash bit for the sign so collisions tend to cancel out.
+		if sum[8]&1 == 0 {
+			vec[bucket]++
+		} else {
+			vec[bucket]--
+		}
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vec {
+			vec[i] *= scale
+		}
+	}
+	return vec, nil
+}
+
+// EmbedBatch embeds each text in turn; hashing is cheap so there is nothing to batch.
+func (e *hashingEmbedder) EmbedBatch(c context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec, err := e.Embed(c, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vec
+	}
+	return vectors, nil
+}
+
+// limitedEmbedder caps how many embedding requests are in flight at once, so
+// parallel indexing workers don't overload a local model server.
+type limitedEmbedder struct {
+	Embedder
+	slots chan struct{}
+}
+
+// NewLimitedEmbedder wraps inner so that at most EMBED_CONCURRENCY (default 2)
+// Embed and EmbedBatch calls run at the same time; the rest wait for a slot.
+func NewLimitedEmbedder(inner Embedder) Embedder {
+	return &limitedEmbedder{Embedder: inner, slots: make(chan struct{}, envIntOrDefault("EMBED_CONCURRENCY", 2))}
+}
+
+func (e *limitedEmbedder) acquire(c context.Context) error {
+	select {
+	case e.slots <- struct{}{}:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+func (e *limitedEmbedder) Embed(c context.Context, textToEmbed string) ([]float32, error) {
+	if err := e.acquire(c); err != nil {
+		return nil, err
+	}
+	defer func() { <-e.slots }()
+	return e.Embedder.Embed(c, textToEmbed)
+}
+
+func (e *limitedEmbedder) EmbedBatch(c context.Context, texts []string) ([][]float32, error) {
+	if err := e.acquire(c); err != nil {
+		return nil, err
+	}
+	defer func() { <-e.slots }()
+	return e.Embedder.EmbedBatch(c, texts)
+}
+
+// httpStatusError is returned by postJSON when the server answers with a non-200 status.
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("api returned non-200 status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// postJSON sends payload as a JSON POST to url and decodes the JSON response into out.
+func postJSON(c context.Context, client *http.Client, url, bearerToken string, payload, out interface{}) error {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(c, http.MethodPost, url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create http request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if bearerToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &httpStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github/itish2003/rag/models"
+)
+
+// maxCachedDimension bounds the vector size accepted from the cache file, well
+// above that of any embedding model in use.
+const maxCachedDimension = 1 << 16
+
+// cacheKey is the SHA-256 of the model name and the exact text that was embedded.
+type cacheKey [sha256.Size]byte
+
+// CachingEmbedder wraps an Embedder with a content-addressed cache persisted to
+// an append-only file, so unchanged chunks are never sent to the model twice.
+//
+// Each record on disk is: 32-byte key | uint32 dimension | dimension x float32 (little endian).
+type CachingEmbedder struct {
+	inner   Embedder
+	mu      sync.RWMutex
+	entries map[cacheKey][]float32
+	file    *os.File
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+// NewCachingEmbedder loads the cache file at path (creating it if needed) and
+// returns an Embedder that consults it before calling inner.
+func NewCachingEmbedder(inner Embedder, path string) (*CachingEmbedder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("could not create cache directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open embedding cache %s: %w", path, err)
+	}
+
+	c := &CachingEmbedder{
+		inner:   inner,
+		entries: make(map[cacheKey][]float32),
+		file:    file,
+	}
+	validBytes, err := c.load()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not read embedding cache %s: %w", path, err)
+	}
+	// Drop a partially written trailing record (e.g. after a crash) and append from there.
+	if err := file.Truncate(validBytes); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not truncate embedding cache %s: %w", path, err)
+	}
+	if _, err := file.Seek(validBytes, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	log.Printf("Embedding cache loaded from %s with %d entries.", path, len(c.entries))
+	return c, nil
+}
+
+// load reads every complete record in the cache file and returns the number of bytes consumed.
+func (c *CachingEmbedder) load() (int64, error) {
+	reader := bufio.NewReader(c.file)
+	var offset int64
+	for {
+		var key cacheKey
+		var dim uint32
+		if _, err := io.ReadFull(reader, key[:]); err != nil {
+			return offset, ignoreEOF(err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &dim); err != nil {
+			return offset, ignoreEOF(err)
+		}
+		// A corrupt or torn record can claim any size; stop at it rather than
+		// allocate for it, and the caller truncates the file there.
+		if dim == 0 || dim > maxCachedDimension {
+			log.Printf("WARN: Embedding cache record at offset %d has invalid dimension %d. Dropping it and the rest of the file.", offset, dim)
+			return offset, nil
+		}
+		vec := make([]float32, dim)
+		if err := binary.Read(reader, binary.LittleEndian, vec); err != nil {
+			return offset, ignoreEOF(err)
+		}
+		c.entries[key] = vec
+		offset += int64(len(key)) + 4 + int64(dim)*4
+	}
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return err
+}
+
+func (c *CachingEmbedder) key(text string) cacheKey {
+	h := sha256.New()
+	h.Write([]byte(c.inner.ModelName()))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	var key cacheKey
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+func (c *CachingEmbedder) ModelName() string {
+	return c.inner.ModelName()
+}
+
+// Embed returns the cached vector for text, embedding and caching it on a miss.
+func (c *CachingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := c.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch serves what it can from the cache and sends only the misses to the model.
+func (c *CachingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	keys := make([]cacheKey, len(texts))
+	var missIdx []int
+	var missTexts []string
+
+	c.mu.RLock()
+	for i, text := range texts {
+		keys[i] = c.key(text)
+		if vec, ok := c.entries[keys[i]]; ok {
+			vectors[i] = vec
+		} else {
+			missIdx = append(missIdx, i)
+			missTexts = append(missTexts, text)
+		}
+	}
+	c.mu.RUnlock()
+
+	c.hits.Add(int64(len(texts) - len(missIdx)))
+	c.misses.Add(int64(len(missIdx)))
+	if len(missIdx) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.inner.EmbedBatch(ctx, missTexts)
+	if err != nil {
+		return nil, err
+	}
+	// An empty vector (Ollama's legacy API returns one for an empty prompt)
+	// is useless to Chroma and would read back as a corrupt record.
+	for j, vec := range embedded {
+		if len(vec) == 0 {
+			return nil, fmt.Errorf("%s returned an empty embedding for text %d of the batch", c.inner.ModelName(), missIdx[j])
+		}
+	}
+
+	var buf bytes.Buffer
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for j, i := range missIdx {
+		vectors[i] = embedded[j]
+		if _, ok := c.entries[keys[i]]; ok {
+			continue
+		}
+		c.entries[keys[i]] = embedded[j]
+		buf.Write(keys[i][:])
+		binary.Write(&buf, binary.LittleEndian, uint32(len(embedded[j])))
+		binary.Write(&buf, binary.LittleEndian, embedded[j])
+	}
+	if _, err := c.file.Write(buf.Bytes()); err != nil {
+		// The vectors are still valid; we just won't have them after a restart.
+		log.Printf("WARN: Failed to persist embedding cache entries: %v", err)
+	}
+	return vectors, nil
+}
+
+// Stats reports the cache hit/miss counters since startup.
+func (c *CachingEmbedder) Stats() models.EmbeddingCacheStats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+	stats := models.EmbeddingCacheStats{
+		Model:   c.inner.ModelName(),
+		Entries: entries,
+		Hits:    hits,
+		Misses:  misses,
+	}
+	if total := hits + misses; total > 0 {
+		stats.HitRate = math.Round(float64(hits)/float64(total)*1000) / 1000
+	}
+	return stats
+}
+
+// Close flushes and closes the cache file.
+func (c *CachingEmbedder) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Sync(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
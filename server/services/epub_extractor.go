@@ -0,0 +1,126 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubContainer is META-INF/container.xml, which points at the package file.
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the parts of the OPF package file we need: the manifest of
+// content files and the spine giving their reading order.
+type epubPackage struct {
+	Title    string `xml:"metadata>title"`
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractTextFromEPUB returns the text of an EPUB's chapters in reading order,
+// with their headings as markdown "#" lines.
+func extractTextFromEPUB(filePath string) (string, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var container epubContainer
+	if err := readZipXML(files, "META-INF/container.xml", &container); err != nil {
+		return "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", fmt.Errorf("epub has no package file")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := readZipXML(files, opfPath, &pkg); err != nil {
+		return "", err
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if strings.Contains(item.MediaType, "html") {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	var chapters []string
+	if title := strings.TrimSpace(pkg.Title); title != "" {
+		chapters = append(chapters, "# "+title)
+	}
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		f, ok := files[path.Join(path.Dir(opfPath), href)]
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		doc, err := html.Parse(rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("could not parse %s: %w", f.Name, err)
+		}
+		body := findElement(doc, atom.Body)
+		if body == nil {
+			continue
+		}
+		if text := renderHTML(body); text != "" {
+			chapters = append(chapters, text)
+		}
+	}
+	return strings.Join(chapters, "\n\n"), nil
+}
+
+// readZipXML decodes the XML file name from the archive into v.
+func readZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("epub is missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not parse %s: %w", name, err)
+	}
+	return nil
+}
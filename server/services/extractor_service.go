@@ -2,27 +2,56 @@ package services
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/joho/godotenv"
-	"github.com/unidoc/unipdf/v3/common/license"
-	"github.com/unidoc/unipdf/v3/extractor"
-	"github.com/unidoc/unipdf/v3/model"
 )
 
-func init() {
+// ExtractedDocument is the text of a file together with the pages it came from.
+type ExtractedDocument struct {
+	Text string
+	// Pages locates each page of a paged format (PDF) in Text; it is empty
+	// for other files.
+	Pages []PageSegment
+	// Extractor is the extractorName of what actually produced Text, which
+	// differs from the configured one when a PDF fell back to the native
+	// backend.
+	Extractor string
+}
+
+// PageSegment is the rune span [Start, End) of page Page (1-based) in the
+// extracted text.
+type PageSegment struct {
+	Page  int
+	Start int
+	End   int
+}
 
-	// Load .env file from the current directory
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, relying on environment variables.")
+// ExtractDocument is ExtractTextFromFile for callers that also need page
+// boundaries.
+func ExtractDocument(path string) (*ExtractedDocument, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return extractPDFDocument(path)
 	}
-	err := license.SetMeteredKey(os.Getenv("UNIDOC_LICENSE_KEY"))
+	text, err := ExtractTextFromFile(path)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to set Unidoc license key: %v. PDF processing will fail.\n", err)
+		return nil, err
+	}
+	return &ExtractedDocument{Text: text, Extractor: extractorName(path)}, nil
+}
+
+// extractorName identifies how the text of path is meant to be extracted when that can
+// change without the file changing (the PDF backend, frontmatter handling of
+// notes), or is empty. It is stored with every chunk so a change re-indexes
+// the file.
+func extractorName(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return "pdf-" + pdfBackend.Name()
+	case ".md":
+		return "md-frontmatter"
 	}
+	return ""
 }
 
 // ExtractTextFromFile reads a file and returns its text content.
@@ -38,49 +67,48 @@ func ExtractTextFromFile(path string) (string, error) {
 		}
 		return string(content), nil
 	case ".pdf":
-		return extractTextFromPDF(path)
+		doc, err := extractPDFDocument(path)
+		if err != nil {
+			return "", err
+		}
+		return doc.Text, nil
+	case ".docx":
+		return extractTextFromDOCX(path)
+	case ".html", ".htm":
+		return extractTextFromHTML(path)
+	case ".epub":
+		return extractTextFromEPUB(path)
+	case ".rtf":
+		return extractTextFromRTF(path)
+	case ".csv", ".json", ".jsonl", ".yaml", ".yml":
+		return extractTextFromStructured(path)
 	default:
+		if codeLanguage(path) != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return string(content), nil
+		}
 		return "", fmt.Errorf("unsupported file type: %s", ext)
 	}
 }
 
-// extractTextFromPDF uses UniPDF to get all text from a PDF file.
-func extractTextFromPDF(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
-	pdfReader, err := model.NewPdfReader(f)
-	if err != nil {
-		return "", err
-	}
-
-	numPages, err := pdfReader.GetNumPages()
-	if err != nil {
-		return "", err
+// pageRange returns the first and last pages whose text overlaps the rune span
+// [start, end), or 0, 0 when there are no pages or the span is unknown.
+func pageRange(pages []PageSegment, start, end int) (int, int) {
+	if start < 0 || end < 0 {
+		return 0, 0
 	}
-
-	var sb strings.Builder
-	for i := 1; i <= numPages; i++ {
-		page, err := pdfReader.GetPage(i)
-		if err != nil {
-			return "", err
+	first, last := 0, 0
+	for _, p := range pages {
+		if p.Start >= p.End || p.End <= start || p.Start >= end {
+			continue
 		}
-
-		ex, err := extractor.New(page)
-		if err != nil {
-			return "", err
+		if first == 0 {
+			first = p.Page
 		}
-
-		text, err := ex.ExtractText()
-		if err != nil {
-			return "", err
-		}
-		sb.WriteString(text)
-		sb.WriteString("\n\n") // Add space between pages
+		last = p.Page
 	}
-
-	return sb.String(), nil
+	return first, last
 }
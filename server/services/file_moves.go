@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+	"github.com/amikos-tech/chroma-go/pkg/embeddings"
+)
+
+// moveIndexedFile re-keys the stored chunks of from to the file now at to,
+// reusing their text and embeddings, so a renamed or moved file is never
+// re-embedded. Chunk IDs are derived from the path, so the records are added
+// under the IDs a fresh index of to would give them and the old ones deleted.
+func (s *FileIndexingService) moveIndexedFile(ctx context.Context, from, to string) error {
+	defer s.locks.Lock(from, to)()
+
+	results, err := s.collection.Get(ctx,
+		chromago.WithWhereGet(chromago.EqString("source_file", from)),
+		chromago.WithIncludeGet(chromago.IncludeDocuments, chromago.IncludeMetadatas, chromago.IncludeEmbeddings),
+	)
+	if err != nil {
+		return err
+	}
+	oldIDs := results.GetIDs()
+	documents := results.GetDocuments()
+	metadatas := results.GetMetadatas()
+	embeddingList := results.GetEmbeddings()
+	if len(oldIDs) == 0 {
+		return fmt.Errorf("no chunks stored for %s", from)
+	}
+	if len(documents) != len(oldIDs) || len(metadatas) != len(oldIDs) || len(embeddingList) != len(oldIDs) {
+		return fmt.Errorf("incomplete records stored for %s", from)
+	}
+
+	// IDs number repeated chunk texts in chunk order, so rebuild them in that order.
+	order := make([]int, len(oldIDs))
+	chunkNums := make([]int, len(oldIDs))
+	for i := range order {
+		order[i] = i
+		chunkNums[i] = metadataInt(metadataToMap(metadatas[i]), "chunk_num", 0)
+	}
+	sort.Slice(order, func(a, b int) bool { return chunkNums[order[a]] < chunkNums[order[b]] })
+	chunks := make([]TextChunk, len(order))
+	for i, idx := range order {
+		chunks[i] = TextChunk{Text: documents[idx].ContentString()}
+	}
+	moved := buildIndexedChunks(to, chunks)
+
+	ids := make([]chromago.DocumentID, len(moved))
+	texts := make([]string, len(moved))
+	vectors := make([]embeddings.Embedding, len(moved))
+	metas := make([]chromago.DocumentMetadata, len(moved))
+	for i, idx := range order {
+		meta := metadatas[idx]
+		meta.SetString("source_file", to)
+		ids[i], texts[i], vectors[i], metas[i] = moved[i].ID, moved[i].Text, embeddingList[idx], meta
+	}
+
+	// Add before deleting, so a failure leaves the old records (which the
+	// next scan removes) rather than none.
+	if err := s.collection.Add(ctx,
+		chromago.WithIDs(ids...),
+		chromago.WithTexts(texts...),
+		chromago.WithEmbeddings(vectors...),
+		chromago.WithMetadatas(metas...),
+	); err != nil {
+		return fmt.Errorf("could not add moved chunks of %s: %w", to, err)
+	}
+	if err := s.collection.Delete(ctx, chromago.WithIDsDelete(oldIDs...)); err != nil {
+		return fmt.Errorf("could not delete chunks of %s: %w", from, err)
+	}
+
+	s.lexical.RemoveByFile(from)
+	for i := range ids {
+		s.lexical.Upsert(string(ids[i]), texts[i], metadataToMap(metas[i]))
+	}
+	s.links.Move(from, to)
+	s.progress.move(from, to)
+	if state, ok := s.manifest.Get(from); ok {
+		state.ChunkIDs = make([]string, len(ids))
+		for i := range ids {
+			state.ChunkIDs[i] = string(ids[i])
+		}
+		sort.Strings(state.ChunkIDs)
+		// The content is unchanged, so the hash stands; a stat failure only
+		// means the next scan hashes the file again.
+		state.ModTime, state.Size = 0, 0
+		if info, err := os.Stat(to); err == nil {
+			state.ModTime, state.Size = info.ModTime().UnixNano(), info.Size()
+		}
+		s.manifest.Set(to, state)
+		s.manifest.Remove(from)
+	}
+	log.Printf("INDEXER: Moved %d chunks from %s to %s without re-embedding.", len(ids), from, to)
+	return nil
+}
+
+// findMoveTarget returns the candidate that holds the content last indexed
+// for the missing file from, or "" if none does. Candidates already in the
+// index are skipped: they are files of their own, not from's new name.
+func (s *FileIndexingService) findMoveTarget(from string, candidates []string) string {
+	state, ok := s.manifest.Get(from)
+	if !ok {
+		return ""
+	}
+	for _, path := range candidates {
+		if path == from {
+			continue
+		}
+		if _, indexed := s.manifest.Get(path); indexed {
+			continue
+		}
+		if hash, err := calculateFileHash(path); err == nil && hash == state.Hash {
+			return path
+		}
+	}
+	return ""
+}
+
+// findMoveSource returns the candidate that no longer exists and was last
+// indexed with hash, the content of the new file to, or "" if none was.
+func (s *FileIndexingService) findMoveSource(to, hash string, candidates []string) string {
+	for _, path := range candidates {
+		if path == to {
+			continue
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if state, ok := s.manifest.Get(path); ok && state.Hash == hash {
+			return path
+		}
+	}
+	return ""
+}
+
+// pathSet remembers the files the watcher saw created, or removed, and has not
+// synced yet. They are the candidates for the other side of a move.
+type pathSet struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func newPathSet() *pathSet {
+	return &pathSet{paths: make(map[string]bool)}
+}
+
+func (c *pathSet) Add(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths[path] = true
+}
+
+func (c *pathSet) Done(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.paths, path)
+}
+
+func (c *pathSet) List() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := make([]string, 0, len(c.paths))
+	for path := range c.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// noteFrontmatter is the parsed YAML frontmatter of an Obsidian note.
+type noteFrontmatter struct {
+	Tags    []string
+	Aliases []string
+	// Created is the "created" property as written; CreatedAt is its Unix
+	// time, or 0 if it is not a date.
+	Created   string
+	CreatedAt int64
+	// Fields holds every other property, flattened like structured-data
+	// records (nested keys joined with dots, lists joined with commas).
+	Fields map[string]string
+}
+
+// createdLayouts are the date formats accepted for the "created" property.
+var createdLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// splitFrontmatter finds a frontmatter block: a "---" line at the very start
+// of content, closed by a "---" or "..." line. It returns the YAML between
+// them and the rune offset at which the note body starts.
+func splitFrontmatter(content string) (string, int, bool) {
+	text := strings.TrimPrefix(content, "\ufeff")
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok || strings.TrimRight(first, "\r") != "---" {
+		return "", 0, false
+	}
+	offset := utf8.RuneCountInString(content) - utf8.RuneCountInString(rest)
+	var yamlLines []string
+	for {
+		line, next, more := strings.Cut(rest, "\n")
+		offset += utf8.RuneCountInString(line)
+		if more {
+			offset++
+		}
+		if trimmed := strings.TrimRight(line, "\r"); trimmed == "---" || trimmed == "..." {
+			return strings.Join(yamlLines, "\n"), offset, true
+		}
+		if !more {
+			return "", 0, false // never closed, so not frontmatter
+		}
+		yamlLines = append(yamlLines, line)
+		rest = next
+	}
+}
+
+// parseFrontmatter decodes the YAML of a frontmatter block. Obsidian's
+// "tags"/"tag" and "aliases"/"alias" may be lists or comma-separated strings.
+func parseFrontmatter(yamlText string) (*noteFrontmatter, error) {
+	fm := &noteFrontmatter{Fields: make(map[string]string)}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(yamlText), &doc); err != nil {
+		return nil, err
+	}
+	value, err := yamlValue(&doc)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := value.(orderedObject)
+	if !ok {
+		return fm, nil // empty or not a mapping
+	}
+	for _, entry := range obj {
+		switch strings.ToLower(entry.Key) {
+		case "tags", "tag":
+			for _, tag := range frontmatterList(entry.Value, true) {
+				fm.Tags = append(fm.Tags, strings.ToLower(strings.TrimPrefix(tag, "#")))
+			}
+		case "aliases", "alias":
+			fm.Aliases = append(fm.Aliases, frontmatterList(entry.Value, false)...)
+		case "created":
+			fm.Created = strings.TrimSpace(scalarString(entry.Value))
+			for _, layout := range createdLayouts {
+				if t, err := time.ParseInLocation(layout, fm.Created, time.Local); err == nil {
+					fm.CreatedAt = t.Unix()
+					break
+				}
+			}
+		default:
+			var fields []recordField
+			flattenValue(entry.Key, entry.Value, &fields)
+			for _, f := range fields {
+				if value := strings.Join(strings.Fields(f.Value), " "); value != "" {
+					fm.Fields[f.Key] = value
+				}
+			}
+		}
+	}
+	return fm, nil
+}
+
+// frontmatterList reads a property that may be a list or a single string of
+// comma-separated items (also space-separated for tags).
+func frontmatterList(value interface{}, splitSpaces bool) []string {
+	var raw []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			raw = append(raw, scalarString(item))
+		}
+	default:
+		raw = strings.Split(scalarString(v), ",")
+	}
+	var items []string
+	for _, item := range raw {
+		parts := []string{item}
+		if splitSpaces {
+			parts = strings.Fields(item)
+		}
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); part != "" {
+				items = append(items, part)
+			}
+		}
+	}
+	return items
+}
+
+// mergeTags returns the distinct tags of both lists, sorted.
+func mergeTags(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var tags []string
+	for _, tag := range append(append([]string{}, a...), b...) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
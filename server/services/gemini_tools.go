@@ -17,6 +17,49 @@ func GetAllTools() []*genai.Tool {
 								Type:        genai.TypeString,
 								Description: "The specific topic or question to search for in the document store. This should be a concise search query.",
 							},
+							"k": {
+								Type:        genai.TypeInteger,
+								Description: "Optional number of passages to return (default 3, max 20). Ask for more when the question needs broad coverage.",
+							},
+							"diversify": {
+								Type:        genai.TypeBoolean,
+								Description: "Optional. Set to true to prefer passages from distinct sources over several overlapping passages from the same note.",
+							},
+							"expand": {
+								Type:        genai.TypeString,
+								Enum:        []string{"neighbors", "section"},
+								Description: "Optional. Widen each passage with surrounding context: 'neighbors' adds the adjacent chunks, 'section' returns the whole markdown section it belongs to. Use when passages look cut off.",
+							},
+							"expand_links": {
+								Type:        genai.TypeBoolean,
+								Description: "Optional. Set to true to also return the best passage from notes linked to or from the matching notes by [[wikilinks]]. Use when the answer likely spans connected notes.",
+							},
+							"source_file": {
+								Type:        genai.TypeString,
+								Description: "Optional glob restricting the search to matching files, e.g. '*.pdf' or 'projects/*.md'.",
+							},
+							"folder": {
+								Type:        genai.TypeString,
+								Description: "Optional folder, relative to the notes directory, to restrict the search to, e.g. 'work'.",
+							},
+							"tags": {
+								Type:        genai.TypeArray,
+								Items:       &genai.Schema{Type: genai.TypeString},
+								Description: "Optional tags (without '#') that matching notes must all carry.",
+							},
+							"fields": {
+								Type:        genai.TypeArray,
+								Items:       &genai.Schema{Type: genai.TypeString},
+								Description: "Optional name=value pairs that CSV, JSON or YAML records must match, e.g. \"author=Ursula K. Le Guin\".",
+							},
+							"modified_after": {
+								Type:        genai.TypeString,
+								Description: "Optional date (YYYY-MM-DD); only search notes modified on or after it.",
+							},
+							"modified_before": {
+								Type:        genai.TypeString,
+								Description: "Optional date (YYYY-MM-DD); only search notes modified on or before it.",
+							},
 						},
 						Required: []string{"query"},
 					},
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// boilerplateTags never contain a page's main content.
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Template: true,
+	atom.Select: true, atom.Link: true, atom.Meta: true,
+}
+
+// boilerplateRegex matches class and id values of page chrome.
+var boilerplateRegex = regexp.MustCompile(`(?i)comment|footer|footnote|sidebar|sponsor|share|social|related|promo|banner|cookie|navbar|menu|breadcrumb|popup|modal|advert|\bads?\b`)
+
+// whitespaceRegex matches runs of whitespace collapsed in rendered HTML text.
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// extractTextFromHTML returns the main content of a saved web page as
+// markdown-style text. Page chrome (navigation, sidebars, footers, scripts)
+// is dropped and, unless the page marks its content with <article> or <main>,
+// the densest block of paragraphs is picked readability-style. Headings
+// become "#" lines so the markdown chunker can follow them.
+func extractTextFromHTML(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	reader, err := charset.NewReader(bytes.NewReader(data), "text/html")
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return "", err
+	}
+
+	title := strings.TrimSpace(nodeText(findElement(doc, atom.Title)))
+	removeBoilerplate(doc)
+	text := renderHTML(mainContent(doc))
+	if title != "" && !strings.HasPrefix(text, "# ") {
+		text = "# " + title + "\n\n" + text
+	}
+	return text, nil
+}
+
+// removeBoilerplate deletes boilerplate elements and hidden nodes in place.
+func removeBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isBoilerplate(c)) {
+			n.RemoveChild(c)
+		} else {
+			removeBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if boilerplateTags[n.DataAtom] {
+		return true
+	}
+	switch n.DataAtom {
+	case atom.Html, atom.Body, atom.Article, atom.Main:
+		return false
+	}
+	if _, ok := attr(n, "hidden"); ok {
+		return true
+	}
+	if v, _ := attr(n, "aria-hidden"); v == "true" {
+		return true
+	}
+	if v, _ := attr(n, "style"); strings.Contains(strings.ReplaceAll(v, " ", ""), "display:none") {
+		return true
+	}
+	class, _ := attr(n, "class")
+	id, _ := attr(n, "id")
+	return boilerplateRegex.MatchString(class + " " + id)
+}
+
+// mainContent picks the element holding the page's main content: an explicit
+// <article>, <main> or role="main" element if there is one with real text,
+// otherwise the block whose paragraphs score best, otherwise <body>.
+func mainContent(doc *html.Node) *html.Node {
+	for _, a := range []atom.Atom{atom.Article, atom.Main} {
+		if n := findElement(doc, a); n != nil && len(nodeText(n)) >= 200 {
+			return n
+		}
+	}
+	if n := findNode(doc, func(n *html.Node) bool { v, _ := attr(n, "role"); return v == "main" }); n != nil {
+		return n
+	}
+
+	// Each substantial paragraph adds to its parent's score and half as much
+	// to its grandparent's, favouring the container with the most prose.
+	scores := make(map[*html.Node]float64)
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td {
+			return
+		}
+		text := nodeText(n)
+		if len(text) < 25 || n.Parent == nil {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		scores[n.Parent] += score
+		if n.Parent.Parent != nil {
+			scores[n.Parent.Parent] += score / 2
+		}
+	})
+	var best *html.Node
+	bestScore := 0.0
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if body := findElement(doc, atom.Body); body != nil {
+		return body
+	}
+	return doc
+}
+
+// linkDensity is the share of n's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			linked += len(nodeText(c))
+		}
+	})
+	return float64(linked) / float64(total)
+}
+
+// renderHTML converts an element tree to plain text with markdown-style
+// headings, list items, code fences and pipe tables.
+func renderHTML(n *html.Node) string {
+	r := &htmlRenderer{}
+	r.render(n)
+	lines := strings.Split(r.sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := strings.Join(lines, "\n")
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(text)
+}
+
+type htmlRenderer struct {
+	sb strings.Builder
+}
+
+// blockBreak starts a new paragraph unless one was just started.
+func (r *htmlRenderer) blockBreak() {
+	s := r.sb.String()
+	if s != "" && !strings.HasSuffix(s, "\n\n") {
+		if strings.HasSuffix(s, "\n") {
+			r.sb.WriteString("\n")
+		} else {
+			r.sb.WriteString("\n\n")
+		}
+	}
+}
+
+// writeInline writes collapsed text, avoiding leading spaces on a line.
+func (r *htmlRenderer) writeInline(text string) {
+	text = whitespaceRegex.ReplaceAllString(text, " ")
+	s := r.sb.String()
+	if s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, " ") {
+		text = strings.TrimLeft(text, " ")
+	}
+	r.sb.WriteString(text)
+}
+
+func (r *htmlRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.writeInline(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.renderChildren(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template:
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		r.blockBreak()
+		r.sb.WriteString(strings.Repeat("#", level) + " " + collapse(nodeText(n)))
+		r.blockBreak()
+	case atom.Br:
+		r.sb.WriteString("\n")
+	case atom.Li:
+		if !strings.HasSuffix(r.sb.String(), "\n") && r.sb.Len() > 0 {
+			r.sb.WriteString("\n")
+		}
+		r.sb.WriteString("- ")
+		r.renderChildren(n)
+		r.sb.WriteString("\n")
+	case atom.Pre:
+		r.blockBreak()
+		r.sb.WriteString("```\n" + strings.Trim(nodeText(n), "\n") + "\n```")
+		r.blockBreak()
+	case atom.Table:
+		r.blockBreak()
+		r.renderTable(n)
+		r.blockBreak()
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Blockquote,
+		atom.Ul, atom.Ol, atom.Dl, atom.Dt, atom.Dd, atom.Figure, atom.Figcaption, atom.Hr:
+		r.blockBreak()
+		r.renderChildren(n)
+		r.blockBreak()
+	default:
+		r.renderChildren(n)
+	}
+}
+
+func (r *htmlRenderer) renderChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+// renderTable writes a table as pipe rows, with a delimiter row after the
+// first so the markdown chunker keeps it whole.
+func (r *htmlRenderer) renderTable(table *html.Node) {
+	rows := 0
+	walkElements(table, func(tr *html.Node) {
+		if tr.DataAtom != atom.Tr {
+			return
+		}
+		var cells []string
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Td || c.DataAtom == atom.Th {
+				cells = append(cells, strings.ReplaceAll(collapse(nodeText(c)), "|", "\\|"))
+			}
+		}
+		if len(cells) == 0 {
+			return
+		}
+		r.sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if rows == 0 {
+			r.sb.WriteString(strings.Repeat("| --- ", len(cells)) + "|\n")
+		}
+		rows++
+	})
+}
+
+// nodeText returns the concatenated text below n.
+func nodeText(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// collapse squeezes whitespace runs to single spaces and trims.
+func collapse(text string) string {
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(text, " "))
+}
+
+// walkElements calls fn for every element below n, depth first.
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
+
+// findElement returns the first element with tag a below n, or nil.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	return findNode(n, func(c *html.Node) bool { return c.DataAtom == a })
+}
+
+// findNode returns the first element below n that match accepts, or nil.
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && match(c) {
+			return c
+		}
+		if found := findNode(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// attr returns the value of n's attribute key and whether it is set.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,62 @@
+package services
+
+import "sort"
+
+// rrfK dampens the contribution of top ranks in reciprocal rank fusion. 60 is
+// the value from the original RRF paper and works well without tuning.
+const rrfK = 60
+
+// retrievedChunk is a chunk returned by one of the retrievers, before fusion.
+type retrievedChunk struct {
+	ID       string
+	Text     string
+	Metadata map[string]interface{}
+	Distance *float64 // Set only by the vector retriever
+}
+
+// fusedChunk is a retrievedChunk with its combined RRF score.
+type fusedChunk struct {
+	retrievedChunk
+	Score       float64
+	RerankScore *float64 // Set once the reranker has scored the chunk
+}
+
+// rankingScore is the score results are finally ordered by: the rerank score
+// when there is one, otherwise the RRF score.
+func (fc fusedChunk) rankingScore() float64 {
+	if fc.RerankScore != nil {
+		return *fc.RerankScore
+	}
+	return fc.Score
+}
+
+// reciprocalRankFusion merges ranked lists into one. Each chunk scores
+// weight / (rrfK + rank) for every list it appears in, so chunks ranked well
+// by several retrievers rise to the top. lists and weights are parallel.
+func reciprocalRankFusion(lists [][]retrievedChunk, weights []float64) []fusedChunk {
+	byID := make(map[string]*fusedChunk)
+	var order []string
+	for li, list := range lists {
+		for rank, ch := range list {
+			fc, ok := byID[ch.ID]
+			if !ok {
+				fc = &fusedChunk{retrievedChunk: ch}
+				byID[ch.ID] = fc
+				order = append(order, ch.ID)
+			} else if fc.Distance == nil {
+				fc.Distance = ch.Distance
+			}
+			fc.Score += weights[li] / float64(rrfK+rank+1)
+		}
+	}
+
+	fused := make([]fusedChunk, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, *byID[id])
+	}
+	// Stable so ties keep first-seen order, i.e. the earlier list wins.
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+	return fused
+}
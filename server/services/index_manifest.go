@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// manifestPageSize is how many records are read from Chroma per request when
+// the manifest or the lexical index is rebuilt.
+const manifestPageSize = 1000
+
+// IndexManifest records what is indexed for every file: its hash, size and
+// modification time, how it was chunked and embedded, and its chunk IDs. It
+// is the indexer's source of truth for change detection, so startup never
+// has to read the whole collection. It also counts the chunks of notes
+// ingested through the API, which belong to no file.
+type IndexManifest struct {
+	mu       sync.RWMutex
+	path     string
+	files    map[string]*IndexState
+	ingested int
+	dirty    bool
+}
+
+// manifestFile is the manifest's on-disk form.
+type manifestFile struct {
+	Files          map[string]*IndexState `json:"files"`
+	IngestedChunks int                    `json:"ingestedChunks"`
+}
+
+// NewIndexManifest loads the manifest persisted at path, or starts an empty one.
+func NewIndexManifest(path string) (*IndexManifest, error) {
+	m := &IndexManifest{path: path, files: make(map[string]*IndexState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read index manifest %s: %w", path, err)
+	}
+	var stored manifestFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("could not parse index manifest %s: %w", path, err)
+	}
+	if stored.Files != nil {
+		m.files = stored.Files
+	}
+	m.ingested = stored.IngestedChunks
+	log.Printf("Index manifest loaded from %s with %d files.", path, len(m.files))
+	return m, nil
+}
+
+// Get returns the state recorded for path.
+func (m *IndexManifest) Get(path string) (IndexState, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.files[path]
+	if !ok {
+		return IndexState{}, false
+	}
+	return *state, true
+}
+
+// Set records the state of path, replacing any earlier one.
+func (m *IndexManifest) Set(path string, state IndexState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[path] = &state
+	m.dirty = true
+}
+
+// Touch updates the recorded size and modification time of an unchanged file,
+// so the next scan can skip hashing it.
+func (m *IndexManifest) Touch(path string, info os.FileInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state, ok := m.files[path]; ok && (state.ModTime != info.ModTime().UnixNano() || state.Size != info.Size()) {
+		state.ModTime, state.Size = info.ModTime().UnixNano(), info.Size()
+		m.dirty = true
+	}
+}
+
+// Remove forgets path.
+func (m *IndexManifest) Remove(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[path]; ok {
+		delete(m.files, path)
+		m.dirty = true
+	}
+}
+
+// AddIngested counts n more chunks of notes ingested through the API.
+func (m *IndexManifest) AddIngested(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ingested += n
+	m.dirty = true
+}
+
+// Snapshot returns a copy of every recorded state, keyed by path.
+func (m *IndexManifest) Snapshot() map[string]IndexState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	files := make(map[string]IndexState, len(m.files))
+	for path, state := range m.files {
+		files[path] = *state
+	}
+	return files
+}
+
+// chunkCount is the number of chunks the manifest accounts for, ingested
+// notes included.
+func (m *IndexManifest) chunkCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := m.ingested
+	for _, state := range m.files {
+		n += len(state.ChunkIDs)
+	}
+	return n
+}
+
+// replace swaps in a complete set of file states and ingested chunk count.
+func (m *IndexManifest) replace(files map[string]*IndexState, ingested int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files, m.ingested = files, ingested
+	m.dirty = true
+}
+
+// Save writes the manifest to disk if it changed since the last save.
+func (m *IndexManifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+	data, err := json.Marshal(manifestFile{Files: m.files, IngestedChunks: m.ingested})
+	if err != nil {
+		return fmt.Errorf("could not encode index manifest: %w", err)
+	}
+	if err := writeFileAtomic(m.path, data); err != nil {
+		return fmt.Errorf("could not write index manifest: %w", err)
+	}
+	m.dirty = false
+	return nil
+}
+
+// reconcileManifest checks the manifest against Chroma and rebuilds it from
+// the collection's metadata if they disagree: on first run, after the
+// manifest was lost, or when Chroma was changed behind the server's back.
+// Agreement is judged by chunk count, so the check is a single Count request;
+// only a rebuild reads the collection, a page at a time.
+func (s *FileIndexingService) reconcileManifest(ctx context.Context) error {
+	total, err := s.collection.Count(ctx)
+	if err != nil {
+		return err
+	}
+	if int(total) == s.manifest.chunkCount() {
+		return nil
+	}
+
+	log.Printf("INDEXER: Index manifest is out of step with ChromaDB (%d chunks). Rebuilding it...", total)
+	files := make(map[string]*IndexState)
+	ingested := 0
+	for offset := 0; ; offset += manifestPageSize {
+		results, err := s.collection.Get(ctx,
+			chromago.WithIncludeGet(chromago.IncludeMetadatas),
+			chromago.WithLimitGet(manifestPageSize),
+			chromago.WithOffsetGet(offset),
+		)
+		if err != nil {
+			return err
+		}
+		ids := results.GetIDs()
+		metadatas := results.GetMetadatas()
+		for i, id := range ids {
+			if i >= len(metadatas) {
+				break
+			}
+			metaMap := metadataToMap(metadatas[i])
+			if metaMap["source"] == "user_input" {
+				ingested++
+				continue
+			}
+			path, state, ok := indexStateFromMetadata(metaMap)
+			if !ok {
+				continue
+			}
+			if _, exists := files[path]; !exists {
+				// Size and modification time are unknown, so the next scan
+				// hashes the file once and then records them.
+				files[path] = &state
+			}
+			files[path].ChunkIDs = append(files[path].ChunkIDs, string(id))
+		}
+		if len(ids) < manifestPageSize {
+			break
+		}
+	}
+	for _, state := range files {
+		sort.Strings(state.ChunkIDs)
+	}
+	s.manifest.replace(files, ingested)
+	log.Printf("INDEXER: Rebuilt index manifest with %d files and %d ingested note chunks.", len(files), ingested)
+	return nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github/itish2003/rag/models"
+)
+
+// Indexing states of a file, as reported by GET /index/jobs.
+const (
+	JobQueued     = "queued"
+	JobExtracting = "extracting"
+	JobEmbedding  = "embedding"
+	JobIndexed    = "indexed"
+	JobFailed     = "failed"
+	JobSkipped    = "skipped"
+)
+
+// IndexProgress reports what the indexer is doing.
+type IndexProgress interface {
+	IndexStatus() models.IndexStatus
+	// IndexJobs lists the tracked files, only those in state if it is not empty.
+	IndexJobs(state string) models.IndexJobsResponse
+}
+
+// ValidJobState reports whether state is one of the Job* states.
+func ValidJobState(state string) bool {
+	switch state {
+	case JobQueued, JobExtracting, JobEmbedding, JobIndexed, JobFailed, JobSkipped:
+		return true
+	}
+	return false
+}
+
+// indexTracker records the state of every file the indexer has seen since
+// startup, and the progress of the current or last scan.
+type indexTracker struct {
+	mu    sync.RWMutex
+	files map[string]*models.IndexJob
+	scan  models.ScanProgress
+}
+
+func newIndexTracker() *indexTracker {
+	return &indexTracker{files: make(map[string]*models.IndexJob)}
+}
+
+// set moves path to state, recording err for failed files.
+func (t *indexTracker) set(path, state string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job := &models.IndexJob{Path: path, State: state, UpdatedAt: time.Now()}
+	if err != nil {
+		job.Error = err.Error()
+	}
+	t.files[path] = job
+}
+
+// indexed marks path as indexed into chunks chunks.
+func (t *indexTracker) indexed(path string, chunks int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[path] = &models.IndexJob{Path: path, State: JobIndexed, Chunks: chunks, UpdatedAt: time.Now()}
+}
+
+// skip marks an unchanged file as skipped, unless it was indexed earlier in
+// this run, which says more.
+func (t *indexTracker) skip(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if job, ok := t.files[path]; ok && job.State == JobIndexed {
+		return
+	}
+	t.files[path] = &models.IndexJob{Path: path, State: JobSkipped, UpdatedAt: time.Now()}
+}
+
+func (t *indexTracker) remove(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.files, path)
+}
+
+// move carries the state of a renamed file over to its new path.
+func (t *indexTracker) move(from, to string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job := &models.IndexJob{Path: to, State: JobIndexed, UpdatedAt: time.Now()}
+	if old, ok := t.files[from]; ok {
+		job.Chunks = old.Chunks
+		delete(t.files, from)
+	}
+	t.files[to] = job
+}
+
+func (t *indexTracker) scanStarted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.scan = models.ScanProgress{Running: true, StartedAt: &now}
+}
+
+func (t *indexTracker) scanFinished() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.scan.Running = false
+	t.scan.FinishedAt = &now
+}
+
+// scanCount adds to the scan's found, queued and done file counters.
+func (t *indexTracker) scanCount(found, queued, done int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scan.FilesFound += found
+	t.scan.FilesQueued += queued
+	t.scan.FilesDone += done
+}
+
+func (t *indexTracker) status() models.IndexStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	status := models.IndexStatus{States: make(map[string]int), LastScan: t.scan}
+	for _, job := range t.files {
+		status.States[job.State]++
+	}
+	status.TotalFiles = status.States[JobIndexed] + status.States[JobSkipped]
+	status.Failed = status.States[JobFailed]
+	status.QueueDepth = status.States[JobQueued]
+	return status
+}
+
+func (t *indexTracker) jobs(state string) models.IndexJobsResponse {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	jobs := make([]models.IndexJob, 0, len(t.files))
+	for _, job := range t.files {
+		if state == "" || job.State == state {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Path < jobs[j].Path })
+	return models.IndexJobsResponse{Scan: t.scan, Count: len(jobs), Jobs: jobs}
+}
+
+// IndexStatus implements IndexProgress.
+func (s *FileIndexingService) IndexStatus() models.IndexStatus {
+	return s.progress.status()
+}
+
+// IndexJobs implements IndexProgress.
+func (s *FileIndexingService) IndexJobs(state string) models.IndexJobsResponse {
+	return s.progress.jobs(state)
+}
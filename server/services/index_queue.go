@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// scanBacklog is how many files a directory scan may queue ahead of the
+// workers before the walk waits for them.
+const scanBacklog = 256
+
+// indexJob asks a worker to extract, chunk and embed one file.
+type indexJob struct {
+	path string
+	hash string
+	info os.FileInfo     // The file as it was when hashed
+	done *sync.WaitGroup // Marked done once the job has run
+	scan bool            // Queued by a directory scan, counted in its progress
+}
+
+// startWorkers launches the indexing workers the first time it is called.
+// They run until ctx is cancelled.
+func (s *FileIndexingService) startWorkers(ctx context.Context) {
+	s.startOnce.Do(func() {
+		for i := 0; i < s.workers; i++ {
+			go s.runWorker(ctx)
+		}
+		log.Printf("INDEXER: Started %d indexing workers.", s.workers)
+	})
+}
+
+func (s *FileIndexingService) runWorker(ctx context.Context) {
+	for {
+		select {
+		case job := <-s.jobs:
+			if err := s.processAndEmbedFile(ctx, job.path, job.hash, job.info); err != nil {
+				log.Printf("INDEXER ERROR: Failed to process file %s: %v", job.path, err)
+				s.progress.set(job.path, JobFailed, err)
+			}
+			if job.scan {
+				s.progress.scanCount(0, 0, 1)
+			}
+			job.done.Done()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueue hands a job to the next free worker, blocking until one takes it.
+// It returns false if ctx is cancelled first.
+func (s *FileIndexingService) enqueue(ctx context.Context, job indexJob) bool {
+	s.progress.set(job.path, JobQueued, nil)
+	job.done.Add(1)
+	select {
+	case s.jobs <- job:
+		return true
+	case <-ctx.Done():
+		job.done.Done()
+		return false
+	}
+}
+
+// indexFile runs a single indexing job and waits for it to finish.
+func (s *FileIndexingService) indexFile(ctx context.Context, job indexJob) {
+	var done sync.WaitGroup
+	job.done = &done
+	if s.enqueue(ctx, job) {
+		done.Wait()
+	}
+}
+
+// pathLocks serialises work on the same file between the scan, the watcher
+// and the workers, which may all reach a file at once.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{locks: make(map[string]*pathLock)}
+}
+
+// Lock locks every path (in sorted order, so two callers locking the same
+// pair cannot deadlock) and returns the function that unlocks them.
+func (l *pathLocks) Lock(paths ...string) (unlock func()) {
+	paths = append([]string{}, paths...)
+	sort.Strings(paths)
+	unique := paths[:0]
+	for i, path := range paths {
+		if i == 0 || path != paths[i-1] {
+			unique = append(unique, path)
+		}
+	}
+
+	held := make([]*pathLock, len(unique))
+	l.mu.Lock()
+	for i, path := range unique {
+		lock, ok := l.locks[path]
+		if !ok {
+			lock = &pathLock{}
+			l.locks[path] = lock
+		}
+		lock.refs++
+		held[i] = lock
+	}
+	l.mu.Unlock()
+
+	for _, lock := range held {
+		lock.mu.Lock()
+	}
+	return func() {
+		for _, lock := range held {
+			lock.mu.Unlock()
+		}
+		l.mu.Lock()
+		for i, path := range unique {
+			if held[i].refs--; held[i].refs == 0 {
+				delete(l.locks, path)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -4,41 +4,89 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
 	"github.com/amikos-tech/chroma-go/pkg/embeddings"
 	"github.com/fsnotify/fsnotify"
-	"github.com/google/uuid"
-	"github.com/tmc/langchaingo/textsplitter"
 )
 
 // FileIndexingService handles scanning, chunking, and embedding files.
 type FileIndexingService struct {
 	collection chromago.Collection
-	ragService RAGService
+	embedder   Embedder
+	lexical    *LexicalIndex    // BM25 index kept in step with the collection
+	links      *LinkGraph       // Wikilinks between notes
+	manifest   *IndexManifest   // What is indexed per file, for change detection
+	chunkers   *ChunkerRegistry // Picks the chunking strategy per file type
+	tokenizer  Tokenizer        // Counts tokens to check chunks against maxTokens
+	maxTokens  int              // Embedder input limit, 0 if unknown
+	resplit    bool             // Re-split oversized chunks instead of only warning
+	batchSize  int              // Number of chunks embedded and added to Chroma per request
+	workers    int              // Number of files indexed concurrently
+	indexCode  bool             // Index source-code files too
+	jobs       chan indexJob    // Feeds files to the workers
+	startOnce  sync.Once
+	locks      *pathLocks    // Keeps two goroutines from indexing the same file at once
+	progress   *indexTracker // Per-file states and scan progress for the status API
 }
 
-// NewFileIndexingService creates a new indexing service.
-func NewFileIndexingService(collection chromago.Collection, ragService RAGService) *FileIndexingService {
+// NewFileIndexingService creates a new indexing service. The embedding batch
+// size is read from EMBED_BATCH_SIZE (default 32). Chunks longer than the
+// embedder's input limit (EMBED_MAX_TOKENS, or the model's known limit) are
+// re-split, or only logged if OVERSIZED_CHUNKS=warn. INDEX_WORKERS (default 4)
+// files are extracted, chunked and embedded at once. Source-code files are
+// only indexed if INDEX_CODE=on, so a notes vault doesn't pick up the code of
+// its plugins and tooling.
+func NewFileIndexingService(collection chromago.Collection, embedder Embedder, lexical *LexicalIndex, links *LinkGraph, manifest *IndexManifest, chunkers *ChunkerRegistry, tokenizer Tokenizer) *FileIndexingService {
 	return &FileIndexingService{
 		collection: collection,
-		ragService: ragService,
+		embedder:   embedder,
+		lexical:    lexical,
+		links:      links,
+		manifest:   manifest,
+		chunkers:   chunkers,
+		tokenizer:  tokenizer,
+		maxTokens:  maxEmbeddingTokens(embedder.ModelName()),
+		resplit:    envOrDefault("OVERSIZED_CHUNKS", "split") != "warn",
+		batchSize:  envIntOrDefault("EMBED_BATCH_SIZE", 32),
+		workers:    max(envIntOrDefault("INDEX_WORKERS", 4), 1),
+		indexCode:  envOrDefault("INDEX_CODE", "off") == "on",
+		jobs:       make(chan indexJob),
+		locks:      newPathLocks(),
+		progress:   newIndexTracker(),
 	}
 }
 
-// IndexState holds the current hash of a file in our index.
+// IndexState is what the index manifest records about an indexed file.
 type IndexState struct {
-	Hash string
+	Hash      string `json:"hash"`
+	Chunker   string `json:"chunker"`             // "<name> <params>", empty for files indexed before chunkers were recorded
+	Extractor string `json:"extractor,omitempty"` // See extractorName
+	Embedder  string `json:"embedder,omitempty"`  // Embedding model, empty if unknown
+	// ModTime (Unix nanoseconds) and Size are the file's when it was hashed.
+	// While both still match, the file is known unchanged without hashing it.
+	ModTime  int64    `json:"mtime"`
+	Size     int64    `json:"size"`
+	ChunkIDs []string `json:"chunkIds"`
 }
 
-// WatchDirectory starts a long-running process to watch for file changes in real-time.
+// WatchDirectory starts a long-running process to watch for file changes in
+// real-time. Every folder under dirPath is watched, including ones created
+// later. Events are debounced per file (WATCH_DEBOUNCE_MS, default 500), and
+// once a file has been quiet its final state is synced: re-indexed if it
+// exists, removed from the index if it doesn't.
 func (s *FileIndexingService) WatchDirectory(ctx context.Context, dirPath string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -46,6 +94,33 @@ func (s *FileIndexingService) WatchDirectory(ctx context.Context, dirPath string
 		return
 	}
 	defer watcher.Close()
+	s.startWorkers(ctx)
+
+	// Settled paths are synced one at a time, so a file is never indexed by
+	// two goroutines at once.
+	settled := make(chan string)
+	pending := newDebouncer(time.Duration(envIntOrDefault("WATCH_DEBOUNCE_MS", 500))*time.Millisecond, func(path string) {
+		select {
+		case settled <- path:
+		case <-ctx.Done():
+		}
+	})
+	defer pending.Stop()
+	// Files created and removed since they last settled are paired up as
+	// moves by content when either side settles, whichever timer fires first.
+	created, removed := newPathSet(), newPathSet()
+
+	go func() {
+		for {
+			select {
+			case path := <-settled:
+				s.syncWatchedFile(ctx, path, created, removed)
+				s.saveLocalIndexes()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
 	// Goroutine to handle events from the watcher.
 	go func() {
@@ -55,33 +130,48 @@ func (s *FileIndexingService) WatchDirectory(ctx context.Context, dirPath string
 				if !ok {
 					return
 				}
-				// We only care about supported file types.
-				if !isSupportedFile(event.Name) {
+				if event.Op == fsnotify.Chmod || inExcludedDir(dirPath, event.Name) {
 					continue
 				}
 
-				log.Printf("WATCHER EVENT: %s", event)
-
-				// A Create or Write event means we need to index the file.
-				// Many editors perform a "write" by creating a temp file and renaming,
-				// which can trigger multiple events. We handle Create and Write the same.
-				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
-					log.Printf("WATCHER: File modified/created: %s. Re-indexing...", event.Name)
-					hash, err := calculateFileHash(event.Name)
-					if err != nil {
-						log.Printf("WATCHER WARN: Could not hash file %s: %v", event.Name, err)
+				// A new folder (or one moved in) is watched, and the files
+				// already in it are indexed, since they were created before
+				// the watch existed.
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if isExcludedDir(info.Name()) {
+							continue
+						}
+						log.Printf("WATCHER: Folder created: %s", event.Name)
+						s.watchTree(watcher, event.Name, func(path string) {
+							created.Add(path)
+							pending.Trigger(path)
+						})
 						continue
 					}
-					// Delete old versions before re-indexing
-					s.deleteDocumentsByFilepath(ctx, event.Name)
-					if err := s.processAndEmbedFile(ctx, event.Name, hash); err != nil {
-						log.Printf("WATCHER ERROR: Failed to process file %s: %v", event.Name, err)
+				}
+
+				if s.isSupportedFile(event.Name) {
+					log.Printf("WATCHER EVENT: %s", event)
+					if event.Has(fsnotify.Create) {
+						created.Add(event.Name)
 					}
-				} else if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
-					// Rename is often treated as Remove by watchers.
-					log.Printf("WATCHER: File removed/renamed: %s. Removing from index...", event.Name)
-					if err := s.deleteDocumentsByFilepath(ctx, event.Name); err != nil {
-						log.Printf("WATCHER ERROR: Failed to delete records for %s: %v", event.Name, err)
+					if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+						removed.Add(event.Name)
+					}
+					pending.Trigger(event.Name)
+					continue
+				}
+
+				// A folder removed or moved away takes its files with it, but
+				// produces no events for them.
+				if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+					prefix := event.Name + string(filepath.Separator)
+					for _, path := range s.lexical.SourceFiles() {
+						if strings.HasPrefix(path, prefix) {
+							removed.Add(path)
+							pending.Trigger(path)
+						}
 					}
 				}
 
@@ -98,60 +188,209 @@ func (s *FileIndexingService) WatchDirectory(ctx context.Context, dirPath string
 	}()
 
 	log.Printf("WATCHER: Watching directory: %s", dirPath)
-	err = watcher.Add(dirPath)
-	if err != nil {
-		log.Printf("WATCHER ERROR: Failed to add path to watcher: %v", err)
-	}
+	s.watchTree(watcher, dirPath, nil)
 
 	// Block until the context is cancelled (e.g., server shutdown).
 	<-ctx.Done()
 }
 
+// watchTree adds a watch for root and every folder under it, except excluded
+// ones. found, if not nil, is called for each supported file in the tree.
+func (s *FileIndexingService) watchTree(watcher *fsnotify.Watcher, root string, found func(path string)) {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("WATCHER WARN: Could not read %s: %v", path, err)
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && isExcludedDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				log.Printf("WATCHER ERROR: Failed to add path to watcher: %v", err)
+			}
+		} else if found != nil && s.isSupportedFile(path) {
+			found(path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("WATCHER ERROR: Error walking the path %s: %v", root, err)
+	}
+}
+
+// syncWatchedFile brings the index in line with the current state of path,
+// whatever sequence of events led to it. A file that disappeared while a file
+// with its content was created was renamed or moved, and its chunks follow it,
+// whichever of the two settles first.
+func (s *FileIndexingService) syncWatchedFile(ctx context.Context, path string, created, removed *pathSet) {
+	created.Done(path)
+	removed.Done(path)
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if _, indexed := s.manifest.Get(path); !indexed {
+			s.progress.remove(path)
+			return // Never indexed, or already moved to its new name.
+		}
+		if to := s.findMoveTarget(path, created.List()); to != "" {
+			log.Printf("WATCHER: File renamed/moved: %s -> %s. Moving index entries...", path, to)
+			err := s.moveIndexedFile(ctx, path, to)
+			if err == nil {
+				return
+			}
+			log.Printf("WATCHER ERROR: Failed to move %s to %s: %v", path, to, err)
+		}
+		log.Printf("WATCHER: File removed/renamed: %s. Removing from index...", path)
+		if err := s.deleteDocumentsByFilepath(ctx, path); err != nil {
+			log.Printf("WATCHER ERROR: Failed to delete records for %s: %v", path, err)
+		}
+	case err != nil:
+		log.Printf("WATCHER WARN: Could not stat file %s: %v", path, err)
+	case info.IsDir():
+		// A folder now occupies the path; its files are handled on their own.
+	default:
+		hash, err := calculateFileHash(path)
+		if err != nil {
+			log.Printf("WATCHER WARN: Could not hash file %s: %v", path, err)
+			s.progress.set(path, JobFailed, err)
+			return
+		}
+		state, indexed := s.manifest.Get(path)
+		if indexed && s.upToDate(path, hash, state) {
+			s.manifest.Touch(path, info)
+			s.progress.skip(path)
+			return // Already indexed, e.g. the new name of a moved file.
+		}
+		// The new name of a moved file may settle before the old one does.
+		if !indexed {
+			if from := s.findMoveSource(path, hash, removed.List()); from != "" {
+				log.Printf("WATCHER: File renamed/moved: %s -> %s. Moving index entries...", from, path)
+				err := s.moveIndexedFile(ctx, from, path)
+				if err == nil {
+					removed.Done(from)
+					return
+				}
+				log.Printf("WATCHER ERROR: Failed to move %s to %s: %v", from, path, err)
+			}
+		}
+		log.Printf("WATCHER: File modified/created: %s. Re-indexing...", path)
+		// processAndEmbedFile diffs against the stored chunks, so only
+		// the chunks that actually changed are replaced.
+		s.indexFile(ctx, indexJob{path: path, hash: hash, info: info})
+	}
+}
+
 // ScanAndIndexDirectory is the main function to sync the directory with ChromaDB.
+// New and changed files are handed to the indexing workers while the tree is
+// walked; deleted files are removed once the workers are done.
 func (s *FileIndexingService) ScanAndIndexDirectory(ctx context.Context, dirPath string) {
 	log.Printf("INDEXER: Starting directory scan for: %s", dirPath)
+	s.startWorkers(ctx)
+	s.progress.scanStarted()
+	defer s.progress.scanFinished()
 
-	indexedFiles, err := s.getCurrentIndexState(ctx)
-	if err != nil {
-		log.Printf("INDEXER ERROR: Could not get current index state: %v", err)
+	if err := s.reconcileManifest(ctx); err != nil {
+		log.Printf("INDEXER ERROR: Could not reconcile the index manifest with ChromaDB: %v", err)
 		return
 	}
+	indexedFiles := s.manifest.Snapshot()
 	log.Printf("INDEXER: Found %d files currently in the index.", len(indexedFiles))
 
+	if err := s.rebuildLexicalIndexIfEmpty(ctx); err != nil {
+		log.Printf("INDEXER ERROR: Could not rebuild lexical index: %v", err)
+	}
+
+	// Indexed files gone from disk may have been renamed or moved while the
+	// server was down; a new file with the same content takes over their chunks.
+	missingByHash := make(map[string][]string)
+	for path, state := range indexedFiles {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			missingByHash[state.Hash] = append(missingByHash[state.Hash], path)
+		}
+	}
+
+	// A feeder passes queued files on to the workers, so indexing starts while
+	// the rest of the tree is still being walked and hashed.
+	var queued sync.WaitGroup
+	pending := make(chan indexJob, scanBacklog)
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		for job := range pending {
+			job.done = &queued
+			if !s.enqueue(ctx, job) {
+				s.progress.remove(job.path) // Cancelled; it is no longer queued.
+			}
+		}
+	}()
+
 	localFiles := make(map[string]bool)
-	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && isSupportedFile(path) {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if info.IsDir() && path != dirPath && isExcludedDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && s.isSupportedFile(path) {
 			localFiles[path] = true
-			hash, err := calculateFileHash(path)
-			if err != nil {
-				log.Printf("INDEXER WARN: Could not hash file %s: %v", path, err)
-				return nil
+			s.progress.scanCount(1, 0, 0)
+			state, ok := indexedFiles[path]
+			hash := state.Hash
+			if !ok || state.ModTime != info.ModTime().UnixNano() || state.Size != info.Size() {
+				if hash, err = calculateFileHash(path); err != nil {
+					log.Printf("INDEXER WARN: Could not hash file %s: %v", path, err)
+					s.progress.set(path, JobFailed, err)
+					return nil
+				}
 			}
 
-			if state, ok := indexedFiles[path]; ok {
-				if state.Hash == hash {
+			if from := missingByHash[hash]; !ok && len(from) > 0 {
+				missingByHash[hash] = from[1:]
+				if err := s.moveIndexedFile(ctx, from[0], path); err != nil {
+					log.Printf("INDEXER ERROR: Failed to move %s to %s: %v", from[0], path, err)
+				} else {
+					state, ok = indexedFiles[from[0]], true
+					delete(indexedFiles, from[0])
+				}
+			}
+			if ok {
+				if s.upToDate(path, hash, state) {
+					if isNote(path) && !s.links.Has(path) {
+						s.indexLinks(path) // Indexed before the link graph existed
+					}
+					s.manifest.Touch(path, info)
+					s.progress.skip(path)
 					return nil // File is unchanged, skip.
 				}
-				log.Printf("INDEXER: File has changed: %s. Re-indexing...", path)
-				if err := s.deleteDocumentsByFilepath(ctx, path); err != nil {
-					log.Printf("INDEXER ERROR: Failed to delete old version of %s: %v", path, err)
-					return nil
+				if state.Hash == hash {
+					log.Printf("INDEXER: Chunking, extraction or embedding settings changed for %s. Re-indexing...", path)
+				} else {
+					log.Printf("INDEXER: File has changed: %s. Re-indexing...", path)
 				}
 			}
 
-			log.Printf("INDEXER: Indexing new/modified file: %s", path)
-			if err := s.processAndEmbedFile(ctx, path, hash); err != nil {
-				log.Printf("INDEXER ERROR: Failed to process file %s: %v", path, err)
-			}
+			log.Printf("INDEXER: Queued new/modified file: %s", path)
+			s.progress.set(path, JobQueued, nil)
+			s.progress.scanCount(0, 1, 0)
+			pending <- indexJob{path: path, hash: hash, info: info, scan: true}
 		}
 		return nil
 	})
+	close(pending)
 	if err != nil {
 		log.Printf("INDEXER ERROR: Error walking the path %s: %v", dirPath, err)
 	}
+	<-fed
+	queued.Wait()
+	if ctx.Err() != nil {
+		log.Println("INDEXER: Directory scan cancelled.")
+		return
+	}
 
 	// Handle deletions
 	for path := range indexedFiles {
@@ -162,95 +401,596 @@ func (s *FileIndexingService) ScanAndIndexDirectory(ctx context.Context, dirPath
 			}
 		}
 	}
+	s.saveLocalIndexes()
 	log.Println("INDEXER: Directory scan finished.")
 }
 
-func (s *FileIndexingService) processAndEmbedFile(ctx context.Context, path, hash string) error {
+// rebuildLexicalIndexIfEmpty backfills the BM25 index from Chroma when it has
+// no entries but the collection does, e.g. on the first start after upgrading.
+func (s *FileIndexingService) rebuildLexicalIndexIfEmpty(ctx context.Context) error {
+	if s.lexical.Len() > 0 {
+		return nil
+	}
+	count, err := s.collection.Count(ctx)
+	if err != nil || count == 0 {
+		return err
+	}
+
+	log.Printf("INDEXER: Lexical index is empty, rebuilding it from %d chunks in Chroma...", count)
+	for offset := 0; ; offset += manifestPageSize {
+		results, err := s.collection.Get(ctx,
+			chromago.WithIncludeGet(chromago.IncludeDocuments, chromago.IncludeMetadatas),
+			chromago.WithLimitGet(manifestPageSize),
+			chromago.WithOffsetGet(offset),
+		)
+		if err != nil {
+			return err
+		}
+		ids := results.GetIDs()
+		documents := results.GetDocuments()
+		metadatas := results.GetMetadatas()
+		for i, id := range ids {
+			if i >= len(documents) {
+				break
+			}
+			var metadata chromago.DocumentMetadata
+			if i < len(metadatas) {
+				metadata = metadatas[i]
+			}
+			s.lexical.Upsert(string(id), documents[i].ContentString(), metadataToMap(metadata))
+		}
+		if len(ids) < manifestPageSize {
+			return nil
+		}
+	}
+}
+
+// saveLocalIndexes persists the BM25 index, the link graph and the index manifest.
+func (s *FileIndexingService) saveLocalIndexes() {
+	if err := s.manifest.Save(); err != nil {
+		log.Printf("INDEXER ERROR: Failed to save index manifest: %v", err)
+	}
+	if err := s.lexical.Save(); err != nil {
+		log.Printf("INDEXER ERROR: Failed to save lexical index: %v", err)
+	}
+	if err := s.links.Save(); err != nil {
+		log.Printf("INDEXER ERROR: Failed to save link graph: %v", err)
+	}
+}
+
+// indexLinks records the wikilinks of an unchanged note without re-indexing it.
+func (s *FileIndexingService) indexLinks(path string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("INDEXER WARN: Could not read %s for links: %v", path, err)
+		return
+	}
+	s.links.SetLinks(path, extractWikilinks(string(content)))
+}
+
+// info is the file as it was when hashed; its size and modification time are
+// recorded in the manifest with hash.
+func (s *FileIndexingService) processAndEmbedFile(ctx context.Context, path, hash string, info os.FileInfo) error {
+	defer s.locks.Lock(path)()
+	s.progress.set(path, JobExtracting, nil)
+
 	// content, err := os.ReadFile(path)
 	// if err != nil {
 	// 	return err
 	// }
 
-	content, err := ExtractTextFromFile(path)
+	doc, err := ExtractDocument(path)
 	if err != nil {
 		return fmt.Errorf("could not extract text from %s: %w", path, err)
 	}
+	content := doc.Text
 
-	splitter := textsplitter.NewRecursiveCharacter(textsplitter.WithChunkSize(1000), textsplitter.WithChunkOverlap(100))
-	chunks, err := splitter.SplitText(string(content))
+	// Wikilinks are taken from the whole note, frontmatter included, since
+	// Obsidian properties can link to notes too.
+	note := isNote(path)
+	if note {
+		s.links.SetLinks(path, extractWikilinks(content))
+	}
+
+	// Frontmatter is metadata, not note text: it is parsed into fileMeta and
+	// only the body is chunked. Chunk offsets still count from the start of
+	// the file.
+	var frontmatter *noteFrontmatter
+	bodyStart := 0
+	if yamlText, start, ok := splitFrontmatter(content); note && ok {
+		bodyStart = start
+		content = string([]rune(content)[start:])
+		if frontmatter, err = parseFrontmatter(yamlText); err != nil {
+			log.Printf("INDEXER WARN: Could not parse frontmatter of %s: %v", path, err)
+		}
+	}
+
+	chunker := s.chunkers.ForFile(path)
+	chunks, err := chunker.Chunk(path, content)
+	if err != nil {
+		return err
+	}
+	for i := range chunks {
+		if bodyStart > 0 && chunks[i].Start >= 0 {
+			chunks[i].Start += bodyStart
+			chunks[i].End += bodyStart
+		}
+	}
+	chunks, oversized, err := enforceTokenLimit(chunks, s.tokenizer, s.maxTokens, s.resplit)
 	if err != nil {
 		return err
 	}
-	log.Printf("INDEXER: Split %s into %d chunks.", path, len(chunks))
+	if oversized > 0 && s.resplit {
+		log.Printf("INDEXER WARN: %d chunks of %s exceeded the %d-token limit of %s and were re-split.", oversized, path, s.maxTokens, s.embedder.ModelName())
+	} else if oversized > 0 {
+		log.Printf("INDEXER WARN: %d chunks of %s exceed the %d-token limit of %s and will be truncated by the model.", oversized, path, s.maxTokens, s.embedder.ModelName())
+	}
+	log.Printf("INDEXER: Split %s into %d chunks with the %s chunker (%s).", path, len(chunks), chunker.Name(), chunker.Params())
+	for i := range chunks {
+		chunks[i].PageStart, chunks[i].PageEnd = pageRange(doc.Pages, chunks[i].Start, chunks[i].End)
+	}
+
+	fileMeta := fileMetadata{ModifiedAt: info.ModTime().Unix(), Chunker: chunker.Name(), ChunkerParams: chunker.Params(), Extractor: doc.Extractor}
+	if note {
+		fileMeta.Tags = extractInlineTags(content)
+	}
+	if frontmatter != nil {
+		fileMeta.Tags = mergeTags(fileMeta.Tags, frontmatter.Tags)
+		fileMeta.Aliases = frontmatter.Aliases
+		fileMeta.Created, fileMeta.CreatedAt = frontmatter.Created, frontmatter.CreatedAt
+		fileMeta.Fields = frontmatter.Fields
+	}
+
+	fileChunks := buildIndexedChunks(path, chunks)
+	// Embeddings from another model cannot be kept, and their IDs would clash
+	// with the new ones, so they are dropped before anything is added.
+	model := s.embedder.ModelName()
+	if state, ok := s.manifest.Get(path); ok && state.Embedder != "" && state.Embedder != model {
+		log.Printf("INDEXER: %s was embedded with %s. Re-embedding it with %s...", path, state.Embedder, model)
+		if err := s.collection.Delete(ctx, chromago.WithWhereDelete(chromago.EqString("source_file", path))); err != nil {
+			return fmt.Errorf("failed to delete chunks of %s embedded with %s: %w", path, state.Embedder, err)
+		}
+		s.lexical.RemoveByFile(path)
+	}
+	storedChunks, err := s.getStoredChunks(ctx, path)
+	if err != nil {
+		return fmt.Errorf("could not load existing chunks of %s: %w", path, err)
+	}
+
+	// Diff the new chunk set against what is already stored. Chunks whose
+	// content is unchanged keep their ID (and embedding); only the rest churn.
+	var added []indexedChunk
+	var updateIDs, replaceIDs []chromago.DocumentID
+	var updateMetas, replaceMetas []chromago.DocumentMetadata
+	for _, ch := range fileChunks {
+		oldMeta, ok := storedChunks[ch.ID]
+		if !ok {
+			added = append(added, ch)
+			continue
+		}
+		delete(storedChunks, ch.ID)
 
+		// Unchanged chunks may have moved position and always belong to a new
+		// file version, so their metadata is refreshed. Chroma merges metadata
+		// on update, so chunks that lose a key (e.g. a removed tag) are
+		// re-added with their stored embedding instead.
+		meta := chunkMetadata(path, hash, fileMeta, ch)
+		if dropsKeys(oldMeta, metadataToMap(meta)) {
+			replaceIDs = append(replaceIDs, ch.ID)
+			replaceMetas = append(replaceMetas, meta)
+		} else {
+			updateIDs = append(updateIDs, ch.ID)
+			updateMetas = append(updateMetas, meta)
+		}
+		s.lexical.Upsert(string(ch.ID), ch.Text, metadataToMap(meta))
+	}
+	stale := make([]chromago.DocumentID, 0, len(storedChunks))
+	for id := range storedChunks {
+		stale = append(stale, id)
+	}
+
+	if len(added) > 0 {
+		s.progress.set(path, JobEmbedding, nil)
+	}
+	for start := 0; start < len(added); start += s.batchSize {
+		end := min(start+s.batchSize, len(added))
+		if err := s.embedAndStoreBatch(ctx, path, hash, fileMeta, added[start:end]); err != nil {
+			return err
+		}
+	}
+
+	if len(updateIDs) > 0 {
+		if err := s.collection.Update(ctx, chromago.WithIDsUpdate(updateIDs...), chromago.WithMetadatasUpdate(updateMetas...)); err != nil {
+			return fmt.Errorf("failed to update metadata of unchanged chunks of %s: %w", path, err)
+		}
+	}
+	if len(replaceIDs) > 0 {
+		if err := s.replaceChunkMetadata(ctx, replaceIDs, replaceMetas); err != nil {
+			return fmt.Errorf("failed to replace metadata of unchanged chunks of %s: %w", path, err)
+		}
+	}
+	kept := len(updateIDs) + len(replaceIDs)
+
+	if len(stale) > 0 {
+		if err := s.collection.Delete(ctx, chromago.WithIDsDelete(stale...)); err != nil {
+			return fmt.Errorf("failed to delete removed chunks of %s: %w", path, err)
+		}
+		for _, id := range stale {
+			s.lexical.Remove(string(id))
+		}
+	}
+
+	chunkIDs := make([]string, len(fileChunks))
+	for i, ch := range fileChunks {
+		chunkIDs[i] = string(ch.ID)
+	}
+	sort.Strings(chunkIDs)
+	s.manifest.Set(path, IndexState{
+		Hash:      hash,
+		Chunker:   chunker.Name() + " " + chunker.Params(),
+		Extractor: fileMeta.Extractor,
+		Embedder:  model,
+		ModTime:   info.ModTime().UnixNano(),
+		Size:      info.Size(),
+		ChunkIDs:  chunkIDs,
+	})
+
+	log.Printf("INDEXER: %s: %d chunks added, %d unchanged, %d removed.", path, len(added), kept, len(stale))
+	s.progress.indexed(path, len(fileChunks))
+	return nil
+}
+
+// indexedChunk is a chunk of a file together with its stable ID and position.
+type indexedChunk struct {
+	TextChunk
+	ID   chromago.DocumentID
+	Num  int
+	Hash string // SHA-256 of Text
+}
+
+// buildIndexedChunks assigns each chunk an ID derived from the file path and
+// the chunk's content hash, so the same text in the same file always maps to
+// the same record. Repeated identical chunks get an occurrence suffix.
+func buildIndexedChunks(path string, chunks []TextChunk) []indexedChunk {
+	result := make([]indexedChunk, len(chunks))
+	seen := make(map[string]int)
+	for i, ch := range chunks {
+		sum := sha256.Sum256([]byte(ch.Text))
+		chunkHash := hex.EncodeToString(sum[:])
+
+		idSum := sha256.Sum256([]byte(path + "\x00" + chunkHash))
+		baseID := hex.EncodeToString(idSum[:16])
+		id := baseID
+		if n := seen[baseID]; n > 0 {
+			id = fmt.Sprintf("%s-%d", baseID, n)
+		}
+		seen[baseID]++
+
+		result[i] = indexedChunk{TextChunk: ch, ID: chromago.DocumentID(id), Num: i, Hash: chunkHash}
+	}
+	return result
+}
+
+// locateChunks finds the rune offsets of each chunk in content. Chunks come
+// from the splitter in document order and may overlap, so each search starts
+// just after the previous chunk's start.
+func locateChunks(content string, chunks []string) [][2]int {
+	offsets := make([][2]int, len(chunks))
+	searchFrom := 0        // byte offset where the next search starts
+	runeAt, byteAt := 0, 0 // rune count of content[:byteAt], advanced incrementally
 	for i, chunk := range chunks {
-		embeddingVector, err := s.ragService.EmbedTextWithOllama(ctx, chunk)
-		if err != nil {
-			return fmt.Errorf("could not embed chunk %d of %s: %w", i, path, err)
+		idx := strings.Index(content[searchFrom:], chunk)
+		if idx < 0 {
+			offsets[i] = [2]int{-1, -1}
+			continue
 		}
-		embedding := embeddings.NewEmbeddingFromFloat32(embeddingVector)
-		metadata := chromago.NewDocumentMetadata(
-			chromago.NewStringAttribute("source_file", path),
-			chromago.NewStringAttribute("file_hash", hash),
-			chromago.NewIntAttribute("chunk_num", int64(i)),
+		start := searchFrom + idx
+		runeAt += utf8.RuneCountInString(content[byteAt:start])
+		byteAt = start
+		offsets[i] = [2]int{runeAt, runeAt + utf8.RuneCountInString(chunk)}
+		_, size := utf8.DecodeRuneInString(content[start:])
+		searchFrom = start + max(size, 1)
+	}
+	return offsets
+}
+
+// fileMetadata holds the per-file attributes copied onto every chunk of a file.
+type fileMetadata struct {
+	ModifiedAt    int64    // Unix seconds
+	Tags          []string // Stored as one tag_<name> boolean per tag
+	Chunker       string   // Name of the chunker that split the file
+	ChunkerParams string   // Its parameters, see Chunker.Params
+	Extractor     string   // See extractorName; not stored when empty
+
+	// From the frontmatter of notes.
+	Aliases   []string          // Stored joined with ", "
+	Created   string            // The "created" property as written
+	CreatedAt int64             // Its Unix time, 0 if it is not a date
+	Fields    map[string]string // Other properties, stored like record fields
+}
+
+// chunkMetadata builds the Chroma metadata stored with every chunk.
+func chunkMetadata(path, fileHash string, fileMeta fileMetadata, ch indexedChunk) chromago.DocumentMetadata {
+	attrs := []*chromago.MetaAttribute{
+		chromago.NewStringAttribute("source_file", path),
+		chromago.NewStringAttribute("file_hash", fileHash),
+		chromago.NewStringAttribute("chunk_hash", ch.Hash),
+		chromago.NewIntAttribute("chunk_num", int64(ch.Num)),
+		chromago.NewIntAttribute("char_start", int64(ch.Start)),
+		chromago.NewIntAttribute("char_end", int64(ch.End)),
+		chromago.NewIntAttribute("modified_at", fileMeta.ModifiedAt),
+		chromago.NewStringAttribute("chunker", fileMeta.Chunker),
+		chromago.NewStringAttribute("chunker_params", fileMeta.ChunkerParams),
+	}
+	if fileMeta.Extractor != "" {
+		attrs = append(attrs, chromago.NewStringAttribute("extractor", fileMeta.Extractor))
+	}
+	for _, tag := range fileMeta.Tags {
+		attrs = append(attrs, chromago.NewBoolAttribute(tagMetadataKey(tag), true))
+	}
+	if len(fileMeta.Aliases) > 0 {
+		attrs = append(attrs, chromago.NewStringAttribute("aliases", strings.Join(fileMeta.Aliases, ", ")))
+	}
+	if fileMeta.Created != "" {
+		attrs = append(attrs, chromago.NewStringAttribute("created", fileMeta.Created))
+	}
+	if fileMeta.CreatedAt != 0 {
+		attrs = append(attrs, chromago.NewIntAttribute("created_at", fileMeta.CreatedAt))
+	}
+	if ch.SectionPath != "" {
+		attrs = append(attrs, chromago.NewStringAttribute("section_path", ch.SectionPath))
+	}
+	if ch.Language != "" {
+		attrs = append(attrs, chromago.NewStringAttribute("language", ch.Language))
+	}
+	if ch.Symbol != "" {
+		attrs = append(attrs, chromago.NewStringAttribute("symbol", ch.Symbol))
+	}
+	if ch.LineStart > 0 {
+		attrs = append(attrs,
+			chromago.NewIntAttribute("line_start", int64(ch.LineStart)),
+			chromago.NewIntAttribute("line_end", int64(ch.LineEnd)),
 		)
-		docID := chromago.DocumentID(fmt.Sprintf("%s-chunk%d", uuid.New().String(), i))
-		err = s.collection.Add(ctx,
-			chromago.WithIDs(docID),
-			chromago.WithTexts(chunk),
-			chromago.WithEmbeddings(embedding),
-			chromago.WithMetadatas(metadata),
+	}
+	if ch.PageStart > 0 {
+		attrs = append(attrs,
+			chromago.NewIntAttribute("page_start", int64(ch.PageStart)),
+			chromago.NewIntAttribute("page_end", int64(ch.PageEnd)),
 		)
-		if err != nil {
-			return fmt.Errorf("failed to add chunk %d of %s to chromadb: %w", i, path, err)
+	}
+	fields := make(map[string]string, len(fileMeta.Fields)+len(ch.Fields))
+	for name, value := range fileMeta.Fields {
+		fields[name] = value
+	}
+	for name, value := range ch.Fields {
+		fields[name] = value
+	}
+	if len(fields) > 0 {
+		names := make([]string, 0, len(fields))
+		for name, value := range fields {
+			names = append(names, name)
+			// Long free-text values are searchable through the chunk text;
+			// only values short enough to filter on are stored.
+			if utf8.RuneCountInString(value) <= maxFieldValueRunes {
+				attrs = append(attrs, chromago.NewStringAttribute(fieldMetadataKey(name), value))
+			}
+		}
+		sort.Strings(names)
+		attrs = append(attrs, chromago.NewStringAttribute("fields", strings.Join(names, ",")))
+	}
+	return chromago.NewDocumentMetadata(attrs...)
+}
+
+// dropsKeys reports whether oldMeta has keys that newMeta no longer sets.
+func dropsKeys(oldMeta, newMeta map[string]interface{}) bool {
+	for k := range oldMeta {
+		if _, ok := newMeta[k]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceChunkMetadata deletes and re-adds chunks with new metadata, reusing
+// their stored documents and embeddings so the model is not called.
+func (s *FileIndexingService) replaceChunkMetadata(ctx context.Context, ids []chromago.DocumentID, metadatas []chromago.DocumentMetadata) error {
+	results, err := s.collection.Get(ctx,
+		chromago.WithIDsGet(ids...),
+		chromago.WithIncludeGet(chromago.IncludeDocuments, chromago.IncludeEmbeddings),
+	)
+	if err != nil {
+		return err
+	}
+	type storedRecord struct {
+		text      string
+		embedding embeddings.Embedding
+	}
+	byID := make(map[chromago.DocumentID]storedRecord, results.Count())
+	documents := results.GetDocuments()
+	embeddingList := results.GetEmbeddings()
+	for i, id := range results.GetIDs() {
+		byID[id] = storedRecord{text: documents[i].ContentString(), embedding: embeddingList[i]}
+	}
+
+	texts := make([]string, len(ids))
+	vectors := make([]embeddings.Embedding, len(ids))
+	for i, id := range ids {
+		rec, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("chunk %s disappeared from the collection", id)
 		}
+		texts[i] = rec.text
+		vectors[i] = rec.embedding
+	}
+
+	if err := s.collection.Delete(ctx, chromago.WithIDsDelete(ids...)); err != nil {
+		return err
+	}
+	return s.collection.Add(ctx,
+		chromago.WithIDs(ids...),
+		chromago.WithTexts(texts...),
+		chromago.WithEmbeddings(vectors...),
+		chromago.WithMetadatas(metadatas...),
+	)
+}
+
+// embedAndStoreBatch embeds a batch of chunks and writes them to Chroma with
+// a single multi-record Add.
+func (s *FileIndexingService) embedAndStoreBatch(ctx context.Context, path, hash string, fileMeta fileMetadata, chunks []indexedChunk) error {
+	texts := make([]string, len(chunks))
+	for i, ch := range chunks {
+		texts[i] = ch.Text
+	}
+	vectors, err := s.embedWithRetry(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("could not embed %d chunks of %s: %w", len(chunks), path, err)
+	}
+
+	ids := make([]chromago.DocumentID, len(chunks))
+	embeddingList := make([]embeddings.Embedding, len(chunks))
+	metadatas := make([]chromago.DocumentMetadata, len(chunks))
+	for i, ch := range chunks {
+		ids[i] = ch.ID
+		embeddingList[i] = embeddings.NewEmbeddingFromFloat32(vectors[i])
+		metadatas[i] = chunkMetadata(path, hash, fileMeta, ch)
+	}
+
+	err = s.collection.Add(ctx,
+		chromago.WithIDs(ids...),
+		chromago.WithTexts(texts...),
+		chromago.WithEmbeddings(embeddingList...),
+		chromago.WithMetadatas(metadatas...),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add %d chunks of %s to chromadb: %w", len(chunks), path, err)
+	}
+	for i, ch := range chunks {
+		s.lexical.Upsert(string(ch.ID), ch.Text, metadataToMap(metadatas[i]))
 	}
 	return nil
 }
 
-func (s *FileIndexingService) getCurrentIndexState(ctx context.Context) (map[string]IndexState, error) {
-	state := make(map[string]IndexState)
-	results, err := s.collection.Get(ctx)
+// embedWithRetry embeds texts as one batch. If the batch fails it is split in
+// half and each half is retried, down to single texts, so one oversized or
+// malformed chunk doesn't sink its neighbours.
+func (s *FileIndexingService) embedWithRetry(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := s.embedder.EmbedBatch(ctx, texts)
+	if err == nil {
+		return vectors, nil
+	}
+	if len(texts) == 1 || ctx.Err() != nil {
+		return nil, err
+	}
+
+	mid := len(texts) / 2
+	log.Printf("INDEXER WARN: Embedding batch of %d failed (%v), retrying at size %d", len(texts), err, mid)
+	left, err := s.embedWithRetry(ctx, texts[:mid])
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.embedWithRetry(ctx, texts[mid:])
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+// indexStateFromMetadata reads the file a chunk belongs to and that file's
+// indexed state from the chunk's metadata.
+func indexStateFromMetadata(metaMap map[string]interface{}) (string, IndexState, bool) {
+	path, ok := metaMap["source_file"].(string)
+	if !ok {
+		return "", IndexState{}, false
+	}
+	hash, ok := metaMap["file_hash"].(string)
+	if !ok {
+		return "", IndexState{}, false
+	}
+	chunker, _ := metaMap["chunker"].(string)
+	params, _ := metaMap["chunker_params"].(string)
+	extractor, _ := metaMap["extractor"].(string)
+	return path, IndexState{Hash: hash, Chunker: chunker + " " + params, Extractor: extractor}, true
+}
+
+// upToDate reports whether the file at path, whose content hashes to hash,
+// is indexed as state with the current chunking, extraction and embedding
+// settings. An unknown embedder is assumed to be the current one.
+func (s *FileIndexingService) upToDate(path, hash string, state IndexState) bool {
+	chunker := s.chunkers.ForFile(path)
+	return state.Hash == hash && state.Chunker == chunker.Name()+" "+chunker.Params() && state.Extractor == extractorName(path) &&
+		(state.Embedder == "" || state.Embedder == s.embedder.ModelName())
+}
+
+// getStoredChunks returns the metadata of all chunks currently stored for path, keyed by ID.
+func (s *FileIndexingService) getStoredChunks(ctx context.Context, path string) (map[chromago.DocumentID]map[string]interface{}, error) {
+	results, err := s.collection.Get(ctx,
+		chromago.WithWhereGet(chromago.EqString("source_file", path)),
+		chromago.WithIncludeGet(chromago.IncludeMetadatas),
+	)
 	if err != nil {
 		return nil, err
 	}
 	metadatas := results.GetMetadatas()
-	for _, meta := range metadatas {
-		if meta != nil {
-			// Try to marshal and unmarshal to map[string]interface{}
-			jsonBytes, err := json.Marshal(meta)
-			if err != nil {
-				continue
-			}
-			var metaMap map[string]interface{}
-			if err := json.Unmarshal(jsonBytes, &metaMap); err != nil {
-				continue
-			}
-			if path, ok := metaMap["source_file"].(string); ok {
-				if hash, ok := metaMap["file_hash"].(string); ok {
-					if _, exists := state[path]; !exists {
-						state[path] = IndexState{Hash: hash}
-					}
-				}
-			}
+	stored := make(map[chromago.DocumentID]map[string]interface{}, results.Count())
+	for i, id := range results.GetIDs() {
+		var metadata chromago.DocumentMetadata
+		if i < len(metadatas) {
+			metadata = metadatas[i]
 		}
+		stored[id] = metadataToMap(metadata)
 	}
-	return state, nil
+	return stored, nil
 }
 
 func (s *FileIndexingService) deleteDocumentsByFilepath(ctx context.Context, path string) error {
+	defer s.locks.Lock(path)()
 	// Use the EqString helper to build a WhereClause for source_file == path
 	where := chromago.EqString("source_file", path)
-	return s.collection.Delete(ctx, chromago.WithWhereDelete(where))
+	if err := s.collection.Delete(ctx, chromago.WithWhereDelete(where)); err != nil {
+		return err
+	}
+	s.lexical.RemoveByFile(path)
+	s.links.Remove(path)
+	s.manifest.Remove(path)
+	s.progress.remove(path)
+	return nil
+}
+
+// isNote reports whether path is a markdown note, whose frontmatter and
+// wikilinks are indexed.
+func isNote(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".md")
+}
+
+// isExcludedDir reports whether folders named name are left out of indexing
+// and watching: hidden folders such as .obsidian or .git, whose files are
+// app state rather than notes, and node_modules.
+func isExcludedDir(name string) bool {
+	return name == "node_modules" || (strings.HasPrefix(name, ".") && name != "." && name != "..")
 }
 
-func isSupportedFile(path string) bool {
+// inExcludedDir reports whether path lies inside an excluded folder under root.
+func inExcludedDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if isExcludedDir(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSupportedFile reports whether path is a file the indexer extracts.
+func (s *FileIndexingService) isSupportedFile(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	switch ext {
-	case ".txt", ".md", ".pdf": // Feel free to add more extensions like .go, .py, etc.
+	case ".txt", ".md", ".pdf", ".docx", ".html", ".htm", ".epub", ".rtf":
 		return true
 	default:
-		return false
+		return (s.indexCode && codeLanguages[ext] != "") || structuredExtensions[ext]
 	}
 }
 
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 tuning constants (the usual Okapi defaults).
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// LexicalIndex is a local BM25 inverted index over the same chunks stored in
+// Chroma. It catches exact terms (error codes, identifiers, acronyms) that
+// dense vectors tend to blur. Only chunk texts and metadata are persisted; the
+// postings are rebuilt on load.
+type LexicalIndex struct {
+	mu       sync.RWMutex
+	path     string
+	docs     map[string]*lexicalDoc
+	postings map[string]map[string]int // term -> chunk ID -> term frequency
+	totalLen int
+	dirty    bool
+}
+
+type lexicalDoc struct {
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	terms    map[string]int
+	length   int
+}
+
+// LexicalHit is a single BM25 search result.
+type LexicalHit struct {
+	ID       string
+	Score    float64
+	Text     string
+	Metadata map[string]interface{}
+}
+
+// NewLexicalIndex loads the index persisted at path, or starts an empty one.
+func NewLexicalIndex(path string) (*LexicalIndex, error) {
+	idx := &LexicalIndex{
+		path:     path,
+		docs:     make(map[string]*lexicalDoc),
+		postings: make(map[string]map[string]int),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read lexical index %s: %w", path, err)
+	}
+
+	var stored map[string]*lexicalDoc
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("could not parse lexical index %s: %w", path, err)
+	}
+	for id, doc := range stored {
+		idx.add(id, doc.Text, doc.Metadata)
+	}
+	idx.dirty = false
+	log.Printf("Lexical index loaded from %s with %d chunks.", path, len(idx.docs))
+	return idx, nil
+}
+
+// Len returns the number of indexed chunks.
+func (l *LexicalIndex) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.docs)
+}
+
+// Upsert adds a chunk or replaces its text and metadata.
+func (l *LexicalIndex) Upsert(id, text string, metadata map[string]interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remove(id)
+	l.add(id, text, metadata)
+}
+
+// Remove deletes chunks by ID.
+func (l *LexicalIndex) Remove(ids ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		l.remove(id)
+	}
+}
+
+// RemoveByFile deletes every chunk whose source_file is path.
+func (l *LexicalIndex) RemoveByFile(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, doc := range l.docs {
+		if doc.Metadata["source_file"] == path {
+			l.remove(id)
+		}
+	}
+}
+
+func (l *LexicalIndex) add(id, text string, metadata map[string]interface{}) {
+	tokens := tokenize(text)
+	terms := make(map[string]int)
+	for _, t := range tokens {
+		terms[t]++
+	}
+	for term, tf := range terms {
+		if l.postings[term] == nil {
+			l.postings[term] = make(map[string]int)
+		}
+		l.postings[term][id] = tf
+	}
+	l.docs[id] = &lexicalDoc{Text: text, Metadata: metadata, terms: terms, length: len(tokens)}
+	l.totalLen += len(tokens)
+	l.dirty = true
+}
+
+func (l *LexicalIndex) remove(id string) {
+	doc, ok := l.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(l.postings[term], id)
+		if len(l.postings[term]) == 0 {
+			delete(l.postings, term)
+		}
+	}
+	l.totalLen -= doc.length
+	delete(l.docs, id)
+	l.dirty = true
+}
+
+// SourceFiles returns the distinct source_file values of all indexed chunks.
+func (l *LexicalIndex) SourceFiles() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	seen := make(map[string]bool)
+	var files []string
+	for _, doc := range l.docs {
+		if path, ok := doc.Metadata["source_file"].(string); ok && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Search scores every chunk containing at least one query term with BM25 and
+// returns the best n. If match is non-nil, only chunks whose metadata it
+// accepts are considered.
+func (l *LexicalIndex) Search(query string, n int, match func(metadata map[string]interface{}) bool) []LexicalHit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.docs) == 0 || n <= 0 {
+		return nil
+	}
+
+	avgLen := float64(l.totalLen) / float64(len(l.docs))
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := l.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (float64(len(l.docs))-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			docLen := float64(l.docs[id].length)
+			f := float64(tf)
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+		}
+	}
+
+	hits := make([]LexicalHit, 0, len(scores))
+	for id, score := range scores {
+		doc := l.docs[id]
+		if match != nil && !match(doc.Metadata) {
+			continue
+		}
+		hits = append(hits, LexicalHit{ID: id, Score: score, Text: doc.Text, Metadata: doc.Metadata})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	return hits
+}
+
+// Save writes the index to disk if it changed since the last save.
+func (l *LexicalIndex) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.dirty {
+		return nil
+	}
+	data, err := json.Marshal(l.docs)
+	if err != nil {
+		return fmt.Errorf("could not encode lexical index: %w", err)
+	}
+	if err := writeFileAtomic(l.path, data); err != nil {
+		return fmt.Errorf("could not write lexical index: %w", err)
+	}
+	l.dirty = false
+	return nil
+}
+
+// tokenize lowercases text and splits it into runs of letters, digits and
+// underscores, so identifiers like ERR_TIMEOUT or getUserID stay whole.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so readers never observe a half-written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
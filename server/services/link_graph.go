@@ -0,0 +1,320 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoteNotFound is returned when a note is not in the link graph.
+var ErrNoteNotFound = errors.New("note not found")
+
+// wikilinkRegex matches [[Target]], [[Target#Heading]], [[Target|Alias]] and
+// embeds (![[Target]]). The first group is the target.
+var wikilinkRegex = regexp.MustCompile(`\[\[([^\[\]|#^]*)(?:[#^][^\[\]|]*)?(?:\|[^\[\]]*)?\]\]`)
+
+// LinkGraph is the graph of [[wikilinks]] between notes. Each note's link
+// targets are stored as written and resolved to note paths when the graph is
+// read, the way Obsidian does, so links to notes created later resolve too.
+type LinkGraph struct {
+	mu     sync.RWMutex
+	path   string
+	links  map[string][]string // note path -> link targets as written
+	byName map[string][]string // lowercase file name -> note paths
+	dirty  bool
+}
+
+// NewLinkGraph loads the graph persisted at path, or starts an empty one.
+func NewLinkGraph(path string) (*LinkGraph, error) {
+	g := &LinkGraph{
+		path:   path,
+		links:  make(map[string][]string),
+		byName: make(map[string][]string),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read link graph %s: %w", path, err)
+	}
+	var stored map[string][]string
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("could not parse link graph %s: %w", path, err)
+	}
+	for note, targets := range stored {
+		g.set(note, targets)
+	}
+	g.dirty = false
+	log.Printf("Link graph loaded from %s with %d notes.", path, len(g.links))
+	return g, nil
+}
+
+// Has reports whether note is in the graph.
+func (g *LinkGraph) Has(note string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	_, ok := g.links[note]
+	return ok
+}
+
+// SetLinks records the outgoing link targets of note, replacing earlier ones.
+func (g *LinkGraph) SetLinks(note string, targets []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.remove(note)
+	g.set(note, targets)
+}
+
+// Remove deletes note and its outgoing links. Links to it from other notes
+// are kept and become unresolved.
+func (g *LinkGraph) Remove(note string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.remove(note)
+}
+
+// Move transfers the outgoing links of a renamed note to its new path.
+func (g *LinkGraph) Move(from, to string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	targets, ok := g.links[from]
+	if !ok {
+		return
+	}
+	g.remove(from)
+	g.remove(to)
+	g.set(to, targets)
+}
+
+func (g *LinkGraph) set(note string, targets []string) {
+	if targets == nil {
+		targets = []string{}
+	}
+	g.links[note] = targets
+	name := strings.ToLower(filepath.Base(note))
+	g.byName[name] = append(g.byName[name], note)
+	g.dirty = true
+}
+
+func (g *LinkGraph) remove(note string) {
+	if _, ok := g.links[note]; !ok {
+		return
+	}
+	delete(g.links, note)
+	name := strings.ToLower(filepath.Base(note))
+	paths := g.byName[name]
+	for i, p := range paths {
+		if p == note {
+			g.byName[name] = append(paths[:i], paths[i+1:]...)
+			break
+		}
+	}
+	if len(g.byName[name]) == 0 {
+		delete(g.byName, name)
+	}
+	g.dirty = true
+}
+
+// Save writes the graph to disk if it changed since the last save.
+func (g *LinkGraph) Save() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.dirty {
+		return nil
+	}
+	data, err := json.Marshal(g.links)
+	if err != nil {
+		return fmt.Errorf("could not encode link graph: %w", err)
+	}
+	if err := writeFileAtomic(g.path, data); err != nil {
+		return fmt.Errorf("could not write link graph: %w", err)
+	}
+	g.dirty = false
+	return nil
+}
+
+// Find resolves a note given as a path (absolute, or relative to notesDir) or
+// as a wikilink target such as "Project Ideas".
+func (g *LinkGraph) Find(note, notesDir string) (string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	candidates := []string{note}
+	if !filepath.IsAbs(note) && notesDir != "" {
+		candidates = append(candidates, filepath.Join(notesDir, note))
+	}
+	for _, c := range candidates {
+		if _, ok := g.links[filepath.Clean(c)]; ok {
+			return filepath.Clean(c), true
+		}
+	}
+	resolved := g.resolve(note, "")
+	return resolved, resolved != ""
+}
+
+// Links returns the notes that note links to, and the link targets that
+// match no note.
+func (g *LinkGraph) Links(note string) (resolved, unresolved []string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	seen := make(map[string]bool)
+	for _, target := range g.links[note] {
+		path := g.resolve(target, note)
+		switch {
+		case path == "":
+			if !seen["?"+target] {
+				seen["?"+target] = true
+				unresolved = append(unresolved, target)
+			}
+		case path != note && !seen[path]:
+			seen[path] = true
+			resolved = append(resolved, path)
+		}
+	}
+	sort.Strings(resolved)
+	return resolved, unresolved
+}
+
+// Backlinks returns the notes that link to note.
+func (g *LinkGraph) Backlinks(note string) []string {
+	_, in := g.adjacency()
+	return in[note]
+}
+
+// Neighborhood returns the notes within depth links of note, following links
+// in both directions, and the links between them.
+func (g *LinkGraph) Neighborhood(note string, depth int) ([]string, [][2]string) {
+	out, in := g.adjacency()
+	dist := map[string]int{note: 0}
+	queue := []string{note}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if dist[current] == depth {
+			continue
+		}
+		for _, next := range append(append([]string{}, out[current]...), in[current]...) {
+			if _, ok := dist[next]; !ok {
+				dist[next] = dist[current] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	nodes := make([]string, 0, len(dist))
+	for n := range dist {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	var edges [][2]string
+	for _, from := range nodes {
+		for _, to := range out[from] {
+			if _, ok := dist[to]; ok {
+				edges = append(edges, [2]string{from, to})
+			}
+		}
+	}
+	return nodes, edges
+}
+
+// adjacency resolves every link once, returning outgoing and incoming notes
+// for each note.
+func (g *LinkGraph) adjacency() (out, in map[string][]string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out = make(map[string][]string, len(g.links))
+	in = make(map[string][]string)
+	for note, targets := range g.links {
+		seen := make(map[string]bool)
+		for _, target := range targets {
+			path := g.resolve(target, note)
+			if path == "" || path == note || seen[path] {
+				continue
+			}
+			seen[path] = true
+			out[note] = append(out[note], path)
+			in[path] = append(in[path], note)
+		}
+	}
+	for _, m := range []map[string][]string{out, in} {
+		for _, paths := range m {
+			sort.Strings(paths)
+		}
+	}
+	return out, in
+}
+
+// resolve maps a link target to a note path: "Note" and "folder/Note" match
+// Note.md, preferring the linking note's folder and then the shortest path.
+// It returns "" if no note matches. Callers hold g.mu.
+func (g *LinkGraph) resolve(target, from string) string {
+	target = strings.TrimSpace(filepath.ToSlash(target))
+	if target == "" {
+		return ""
+	}
+	target = strings.TrimPrefix(strings.ToLower(target), "/")
+	// "Note" links Note.md; "v1.2 plan" has an extension-like suffix but
+	// still names a note, so the target is tried with .md added as well.
+	names := []string{target + ".md"}
+	if strings.HasSuffix(target, ".md") {
+		names = []string{target}
+	}
+	var matches []string
+	for _, name := range names {
+		for _, path := range g.byName[filepath.Base(name)] {
+			slashed := strings.ToLower(filepath.ToSlash(path))
+			if slashed == name || strings.HasSuffix(slashed, "/"+name) {
+				matches = append(matches, path)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if from != "" {
+			if sameA, sameB := filepath.Dir(a) == filepath.Dir(from), filepath.Dir(b) == filepath.Dir(from); sameA != sameB {
+				return sameA
+			}
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return matches[0]
+}
+
+// extractWikilinks returns the distinct link targets in markdown text,
+// skipping fenced code blocks.
+func extractWikilinks(text string) []string {
+	seen := make(map[string]bool)
+	var targets []string
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		for _, m := range wikilinkRegex.FindAllStringSubmatch(line, -1) {
+			target := strings.TrimSpace(m[1])
+			if target != "" && !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
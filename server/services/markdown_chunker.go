@@ -0,0 +1,216 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// breadcrumbSeparator joins heading titles in a chunk's section path.
+const breadcrumbSeparator = " > "
+
+// tableSeparatorRegex matches the delimiter row of a GitHub-flavoured table,
+// e.g. "| --- | :-: |".
+var tableSeparatorRegex = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// mdBlock is a structural unit of a markdown document: a heading, a
+// paragraph or list, a fenced code block or a table.
+type mdBlock struct {
+	start, end int // rune offsets [start, end) in the document
+	level      int // heading level, 0 for non-heading blocks
+	title      string
+	atomic     bool // code fences and tables are never split
+}
+
+// mdLine is one line of the document without its newline.
+type mdLine struct {
+	text  string
+	start int // rune offset of the line in the document
+}
+
+// splitMarkdown chunks a markdown document along its heading hierarchy.
+// Chunks never cross a heading; within a section, blocks are packed up to
+// chunkSize, as measured by lenFunc. Code fences and tables are kept whole
+// even if they exceed chunkSize, while oversized paragraphs fall back to the
+// recursive character splitter. Each chunk's text is prefixed with its heading
+// breadcrumb so the embedding knows where the passage sits.
+func splitMarkdown(content string, chunkSize, chunkOverlap int, lenFunc func(string) int) ([]TextChunk, error) {
+	runes := []rune(content)
+	blocks := parseMarkdownBlocks(content)
+
+	var chunks []TextChunk
+	var headings []mdBlock // the open heading stack
+	var pending []mdBlock  // blocks of the chunk being built
+	hasContent := false    // whether pending holds anything besides headings
+	sectionPath := ""
+	size := func(start, end int) int { return lenFunc(string(runes[start:end])) }
+
+	emit := func(start, end int, path string) {
+		body := string(runes[start:end])
+		if strings.TrimSpace(body) == "" {
+			return
+		}
+		chunks = append(chunks, TextChunk{Text: withBreadcrumb(path, body), Start: start, End: end, SectionPath: path})
+	}
+	flush := func() {
+		if len(pending) > 0 {
+			emit(pending[0].start, pending[len(pending)-1].end, sectionPath)
+		}
+		pending, hasContent = nil, false
+	}
+
+	for _, b := range blocks {
+		if b.level > 0 {
+			// A heading opens a new section. Headings with nothing under them
+			// yet stay pending so they end up in the next chunk.
+			if hasContent {
+				flush()
+			}
+			for len(headings) > 0 && headings[len(headings)-1].level >= b.level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, b)
+			sectionPath = breadcrumb(headings)
+			pending = append(pending, b)
+			continue
+		}
+
+		if hasContent && size(pending[0].start, b.end) > chunkSize {
+			flush()
+		}
+		if b.atomic || size(b.start, b.end) <= chunkSize {
+			pending = append(pending, b)
+			hasContent = true
+			continue
+		}
+
+		// An oversized paragraph: split it on its own, with any pending
+		// headings attached to the first piece.
+		blockText := string(runes[b.start:b.end])
+		pieces, err := splitPlainText(blockText, chunkSize, chunkOverlap, lenFunc)
+		if err != nil {
+			return nil, err
+		}
+		for i, piece := range pieces {
+			if piece.Start < 0 {
+				chunks = append(chunks, TextChunk{Text: withBreadcrumb(sectionPath, piece.Text), Start: -1, End: -1, SectionPath: sectionPath})
+				continue
+			}
+			start := b.start + piece.Start
+			if i == 0 && len(pending) > 0 {
+				start = pending[0].start
+			}
+			emit(start, b.start+piece.End, sectionPath)
+		}
+		pending, hasContent = nil, false
+	}
+	flush()
+	return chunks, nil
+}
+
+// parseMarkdownBlocks splits a document into headings, fenced code blocks,
+// tables and paragraphs. Blank lines separate paragraphs and are not part of
+// any block.
+func parseMarkdownBlocks(content string) []mdBlock {
+	var lines []mdLine
+	pos := 0
+	for _, text := range strings.Split(content, "\n") {
+		lines = append(lines, mdLine{text: text, start: pos})
+		pos += utf8.RuneCountInString(text) + 1
+	}
+	lineEnd := func(i int) int {
+		return lines[i].start + utf8.RuneCountInString(lines[i].text)
+	}
+
+	var blocks []mdBlock
+	for i := 0; i < len(lines); {
+		trimmed := strings.TrimSpace(lines[i].text)
+		switch {
+		case trimmed == "":
+			i++
+		case fenceMarker(trimmed) != "":
+			marker := fenceMarker(trimmed)
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j].text), marker) {
+				j++
+			}
+			j = min(j, len(lines)-1) // an unclosed fence runs to the end
+			blocks = append(blocks, mdBlock{start: lines[i].start, end: lineEnd(j), atomic: true})
+			i = j + 1
+		case headingLevel(lines[i].text) > 0:
+			level := headingLevel(lines[i].text)
+			title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(lines[i].text[level:]), "#"))
+			blocks = append(blocks, mdBlock{start: lines[i].start, end: lineEnd(i), level: level, title: title})
+			i++
+		case isTableStart(lines, i):
+			j := i
+			for j+1 < len(lines) && strings.TrimSpace(lines[j+1].text) != "" && strings.Contains(lines[j+1].text, "|") {
+				j++
+			}
+			blocks = append(blocks, mdBlock{start: lines[i].start, end: lineEnd(j), atomic: true})
+			i = j + 1
+		default:
+			j := i
+			for j+1 < len(lines) {
+				next := strings.TrimSpace(lines[j+1].text)
+				if next == "" || fenceMarker(next) != "" || headingLevel(lines[j+1].text) > 0 || isTableStart(lines, j+1) {
+					break
+				}
+				j++
+			}
+			blocks = append(blocks, mdBlock{start: lines[i].start, end: lineEnd(j)})
+			i = j + 1
+		}
+	}
+	return blocks
+}
+
+// fenceMarker returns the opening run of a code fence line ("```" or "~~~",
+// possibly longer), or "" if the line does not open a fence.
+func fenceMarker(trimmed string) string {
+	for _, ch := range []string{"`", "~"} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == ch[0] {
+			n++
+		}
+		if n >= 3 {
+			return trimmed[:n]
+		}
+	}
+	return ""
+}
+
+// isTableStart reports whether lines[i] is a table header row, i.e. contains
+// a pipe and is followed by a delimiter row.
+func isTableStart(lines []mdLine, i int) bool {
+	return i+1 < len(lines) &&
+		strings.Contains(lines[i].text, "|") &&
+		strings.Contains(lines[i+1].text, "-") &&
+		tableSeparatorRegex.MatchString(lines[i+1].text)
+}
+
+// breadcrumb joins the titles of the open headings.
+func breadcrumb(headings []mdBlock) string {
+	titles := make([]string, len(headings))
+	for i, h := range headings {
+		titles[i] = h.title
+	}
+	return strings.Join(titles, breadcrumbSeparator)
+}
+
+// withBreadcrumb prefixes a chunk body with its section path.
+func withBreadcrumb(sectionPath, body string) string {
+	if sectionPath == "" {
+		return body
+	}
+	return sectionPath + "\n\n" + body
+}
+
+// chunkBody strips the breadcrumb withBreadcrumb added, returning the text
+// exactly as it appears in the source document.
+func chunkBody(text, sectionPath string) string {
+	if sectionPath == "" {
+		return text
+	}
+	return strings.TrimPrefix(text, sectionPath+"\n\n")
+}
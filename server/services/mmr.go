@@ -0,0 +1,79 @@
+package services
+
+import "math"
+
+// mmrSelect picks k candidates by Maximal Marginal Relevance. Each step takes
+// the candidate maximising
+//
+//	lambda*relevance - (1-lambda)*max similarity to the already selected ones
+//
+// so lambda=1 is plain relevance ranking and lower values favour diversity.
+// relevance and vectors are parallel; relevance is min-max normalised first so
+// it is on the same scale as cosine similarity. Returns indices in pick order.
+func mmrSelect(relevance []float64, vectors [][]float32, k int, lambda float64) []int {
+	n := len(relevance)
+	if k > n {
+		k = n
+	}
+	norm := normalizeScores(relevance)
+
+	selected := make([]int, 0, k)
+	picked := make([]bool, n)
+	// maxSim[i] is candidate i's highest similarity to anything selected so far.
+	maxSim := make([]float64, n)
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := 0; i < n; i++ {
+			if picked[i] {
+				continue
+			}
+			score := lambda*norm[i] - (1-lambda)*maxSim[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked[best] = true
+		selected = append(selected, best)
+		for i := 0; i < n; i++ {
+			if !picked[i] {
+				maxSim[i] = math.Max(maxSim[i], cosineSimilarity(vectors[i], vectors[best]))
+			}
+		}
+	}
+	return selected
+}
+
+// normalizeScores rescales scores linearly onto [0, 1].
+func normalizeScores(scores []float64) []float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range scores {
+		lo, hi = math.Min(lo, s), math.Max(hi, s)
+	}
+	norm := make([]float64, len(scores))
+	for i, s := range scores {
+		if hi > lo {
+			norm[i] = (s - lo) / (hi - lo)
+		} else {
+			norm[i] = 1
+		}
+	}
+	return norm
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// either is empty or they differ in length.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/unidoc/unipdf/v3/common/license"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// PDFBackend extracts the text of a PDF file.
+type PDFBackend interface {
+	// ExtractPages returns the text of each page, in page order.
+	ExtractPages(path string) ([]string, error)
+	// Name identifies the backend in logs, e.g. "native".
+	Name() string
+}
+
+// pdfBackend is the backend ExtractTextFromFile uses for PDFs. It defaults to
+// the offline extractor until main installs the configured one.
+var pdfBackend PDFBackend = nativePDFBackend{}
+
+// SetPDFBackend replaces the backend used for PDF files. It must be called
+// before indexing starts.
+func SetPDFBackend(backend PDFBackend) {
+	pdfBackend = backend
+}
+
+// NewPDFBackendFromEnv picks the PDF backend from PDF_BACKEND: "unidoc" for
+// UniPDF (needs a metered UNIDOC_LICENSE_KEY and network access), "native"
+// for the pure-Go extractor, or empty to use UniPDF only when a key is set.
+func NewPDFBackendFromEnv() (PDFBackend, error) {
+	key := os.Getenv("UNIDOC_LICENSE_KEY")
+	switch backend := strings.ToLower(os.Getenv("PDF_BACKEND")); backend {
+	case "":
+		if key == "" {
+			return nativePDFBackend{}, nil
+		}
+		unidoc, err := newUniDocPDFBackend(key)
+		if err != nil {
+			log.Printf("WARN: %v. Falling back to the native PDF extractor.", err)
+			return nativePDFBackend{}, nil
+		}
+		return unidoc, nil
+	case "unidoc":
+		if key == "" {
+			return nil, fmt.Errorf("PDF_BACKEND=unidoc requires UNIDOC_LICENSE_KEY")
+		}
+		return newUniDocPDFBackend(key)
+	case "native":
+		return nativePDFBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown PDF_BACKEND %q", backend)
+	}
+}
+
+// extractPDFDocument joins the pages from the configured backend, recording
+// where each page lands in the text. If UniPDF fails on a file (a metering
+// outage, say) the native extractor is tried, and the document records that
+// it produced the text, so the file is re-extracted once UniPDF works again.
+func extractPDFDocument(path string) (*ExtractedDocument, error) {
+	backend := pdfBackend
+	pages, err := backend.ExtractPages(path)
+	if err != nil {
+		if _, native := pdfBackend.(nativePDFBackend); native {
+			return nil, err
+		}
+		log.Printf("WARN: %s PDF backend failed on %s: %v. Trying the native extractor.", pdfBackend.Name(), path, err)
+		backend = nativePDFBackend{}
+		if pages, err = backend.ExtractPages(path); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &ExtractedDocument{Pages: make([]PageSegment, 0, len(pages)), Extractor: "pdf-" + backend.Name()}
+	var sb strings.Builder
+	offset := 0
+	for i, page := range pages {
+		if i > 0 {
+			sb.WriteString("\n\n") // Add space between pages
+			offset += 2
+		}
+		sb.WriteString(page)
+		n := utf8.RuneCountInString(page)
+		doc.Pages = append(doc.Pages, PageSegment{Page: i + 1, Start: offset, End: offset + n})
+		offset += n
+	}
+	doc.Text = sb.String()
+	return doc, nil
+}
+
+// uniDocPDFBackend uses UniPDF, whose metered license is checked online.
+type uniDocPDFBackend struct{}
+
+func newUniDocPDFBackend(key string) (PDFBackend, error) {
+	if err := license.SetMeteredKey(key); err != nil {
+		return nil, fmt.Errorf("failed to set UniDoc license key: %w", err)
+	}
+	return uniDocPDFBackend{}, nil
+}
+
+func (uniDocPDFBackend) Name() string { return "unidoc" }
+
+func (uniDocPDFBackend) ExtractPages(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]string, 0, numPages)
+	for i := 1; i <= numPages; i++ {
+		page, err := pdfReader.GetPage(i)
+		if err != nil {
+			return nil, err
+		}
+
+		ex, err := extractor.New(page)
+		if err != nil {
+			return nil, err
+		}
+
+		text, err := ex.ExtractText()
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, text)
+	}
+	return pages, nil
+}
+
+// nativePDFBackend is a pure-Go extractor that works offline. It lays out the
+// positioned glyphs of each page itself, since PDFs rarely store the spaces
+// and line breaks between words.
+type nativePDFBackend struct{}
+
+func (nativePDFBackend) Name() string { return "native" }
+
+func (nativePDFBackend) ExtractPages(path string) (pages []string, err error) {
+	// The parser panics on malformed files instead of returning errors.
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("could not parse PDF: %v", r)
+		}
+	}()
+
+	f, reader, err := pdf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	numPages := reader.NumPage()
+	pages = make([]string, 0, numPages)
+	for i := 1; i <= numPages; i++ {
+		text, err := nativePageText(reader.Page(i))
+		if err != nil {
+			log.Printf("WARN: Skipping page %d of %s: %v", i, path, err)
+			text = ""
+		}
+		pages = append(pages, text)
+	}
+	return pages, nil
+}
+
+// nativePageText recovers from a panic on one page so the rest of the file
+// can still be read.
+func nativePageText(page pdf.Page) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("%v", r)
+		}
+	}()
+	if page.V.IsNull() {
+		return "", nil
+	}
+	return layoutPDFText(page.Content().Text), nil
+}
+
+// layoutPDFText joins glyphs in content-stream order, starting a new line when
+// the baseline moves, a new paragraph when it jumps by more than a line, and
+// inserting a space where the gap to the previous glyph is wider than a
+// fraction of the font size.
+func layoutPDFText(glyphs []pdf.Text) string {
+	var sb strings.Builder
+	var prev *pdf.Text
+	for i := range glyphs {
+		g := &glyphs[i]
+		if g.S == "" {
+			continue
+		}
+		if prev != nil {
+			size := math.Max(math.Max(prev.FontSize, g.FontSize), 1)
+			dy := prev.Y - g.Y
+			switch {
+			case dy > size*1.8:
+				sb.WriteString("\n\n")
+			case math.Abs(dy) > size*0.5:
+				sb.WriteString("\n")
+			case g.X-(prev.X+prev.W) > size*0.15 && !strings.HasSuffix(sb.String(), " ") && !strings.HasPrefix(g.S, " "):
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(g.S)
+		prev = g
+	}
+
+	var lines []string
+	for _, line := range strings.Split(sb.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" && len(lines) > 0 && lines[len(lines)-1] == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
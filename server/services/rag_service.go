@@ -3,16 +3,18 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github/itish2003/rag/models"
 
@@ -27,14 +29,32 @@ type RAGService interface {
 	IngestNote(c context.Context, req models.IngestDataRequest) error
 	QueryRAG(c context.Context, req models.QueryTextRequest, fileHeader *multipart.FileHeader) (*models.QueryRAGResponse, error)
 	GetAllNotes(c context.Context) (*models.GetAllNotesResponse, error)
-	EmbedTextWithOllama(ctx context.Context, textToEmbed string) ([]float32, error)
 	GetTotalChunks(c context.Context) (int, error)
+	GetEmbeddingCacheStats() *models.EmbeddingCacheStats
+	GetNoteLinks(c context.Context, note string, depth int) (*models.NoteLinksResponse, error)
 }
 
+const (
+	// defaultRetrievalK is how many chunks a retrieval returns unless the request or model asks otherwise.
+	defaultRetrievalK = 3
+	// maxRetrievalK caps k so a single tool call can't flood the context window.
+	maxRetrievalK = 20
+	// defaultMMRLambda balances relevance against diversity when MMR is on.
+	defaultMMRLambda = 0.5
+	// maxLinkDepth caps how many links away GetNoteLinks walks from a note.
+	maxLinkDepth = 3
+)
+
 // ragServiceImpl holds the dependencies it needs to do its job
 type ragServiceImpl struct {
 	httpClient   *http.Client
 	collection   chromago.Collection // Changed from pointer to interface
+	embedder     Embedder
+	lexical      *LexicalIndex
+	links        *LinkGraph
+	manifest     *IndexManifest
+	reranker     Reranker // Optional; nil disables the reranking stage
+	rerankTopN   int      // Number of fused candidates passed to the reranker
 	geminiClient *genai.Client
 	FileActions  *FileActions
 	chatSessions map[string]*genai.Chat
@@ -50,6 +70,49 @@ func (r *ragServiceImpl) GetTotalChunks(c context.Context) (int, error) {
 	return int(count), nil
 }
 
+// GetEmbeddingCacheStats returns the embedding cache counters, or nil when the
+// configured embedder is not cached.
+func (r *ragServiceImpl) GetEmbeddingCacheStats() *models.EmbeddingCacheStats {
+	cached, ok := r.embedder.(interface {
+		Stats() models.EmbeddingCacheStats
+	})
+	if !ok {
+		return nil
+	}
+	stats := cached.Stats()
+	return &stats
+}
+
+// GetNoteLinks returns a note's outgoing links and backlinks, and the notes
+// within depth links of it (default 1, at most maxLinkDepth). note may be a
+// path or a wikilink target; ErrNoteNotFound is returned if it matches no note.
+func (r *ragServiceImpl) GetNoteLinks(c context.Context, note string, depth int) (*models.NoteLinksResponse, error) {
+	path, ok := r.links.Find(note, r.FileActions.NotesDir)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoteNotFound, note)
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	depth = min(depth, maxLinkDepth)
+
+	outgoing, unresolved := r.links.Links(path)
+	nodes, edges := r.links.Neighborhood(path, depth)
+	response := &models.NoteLinksResponse{
+		Note:       path,
+		Outgoing:   append([]string{}, outgoing...),
+		Backlinks:  append([]string{}, r.links.Backlinks(path)...),
+		Unresolved: append([]string{}, unresolved...),
+		Depth:      depth,
+		Nodes:      nodes,
+		Edges:      make([]models.LinkEdge, 0, len(edges)),
+	}
+	for _, e := range edges {
+		response.Edges = append(response.Edges, models.LinkEdge{From: e[0], To: e[1]})
+	}
+	return response, nil
+}
+
 // GetAllNotes implements RAGService to retrieve all documents from ChromaDB.
 func (r *ragServiceImpl) GetAllNotes(c context.Context) (*models.GetAllNotesResponse, error) {
 	log.Printf("SERVICE: Getting all notes from ChromaDB...")
@@ -112,7 +175,7 @@ func (r *ragServiceImpl) GetAllNotes(c context.Context) (*models.GetAllNotesResp
 func (r *ragServiceImpl) IngestNote(c context.Context, req models.IngestDataRequest) error {
 	log.Printf("SERVICE: Ingesting note: '%s'", req.Text)
 
-	embeddingVector, err := r.EmbedTextWithOllama(c, req.Text)
+	embeddingVector, err := r.embedder.Embed(c, req.Text)
 	if err != nil {
 		return fmt.Errorf("could not generate embedding for note: %w", err)
 	}
@@ -123,11 +186,15 @@ func (r *ragServiceImpl) IngestNote(c context.Context, req models.IngestDataRequ
 	// Create metadata
 	metadata := chromago.NewDocumentMetadata(
 		chromago.NewStringAttribute("source", "user_input"),
+		chromago.NewIntAttribute("chunk_num", 0),
+		chromago.NewIntAttribute("char_start", 0),
+		chromago.NewIntAttribute("char_end", int64(utf8.RuneCountInString(req.Text))),
 	)
 
 	// Use the proper embedding type
+	docID := uuid.New().String()
 	err = r.collection.Add(c,
-		chromago.WithIDs(chromago.DocumentID(uuid.New().String())),
+		chromago.WithIDs(chromago.DocumentID(docID)),
 		chromago.WithTexts(req.Text),
 		chromago.WithEmbeddings(embedding),
 		chromago.WithMetadatas(metadata),
@@ -136,6 +203,21 @@ func (r *ragServiceImpl) IngestNote(c context.Context, req models.IngestDataRequ
 		return fmt.Errorf("failed to add record to chromadb: %w", err)
 	}
 
+	// Keep the lexical index in step with Chroma so the note is searchable by keyword too.
+	if r.lexical != nil {
+		r.lexical.Upsert(docID, req.Text, metadataToMap(metadata))
+		if err := r.lexical.Save(); err != nil {
+			log.Printf("WARN: Failed to save lexical index: %v", err)
+		}
+	}
+	// Count the note so the indexer's manifest stays in step with Chroma.
+	if r.manifest != nil {
+		r.manifest.AddIngested(1)
+		if err := r.manifest.Save(); err != nil {
+			log.Printf("WARN: Failed to save index manifest: %v", err)
+		}
+	}
+
 	log.Printf("SERVICE: Successfully added document")
 	return nil
 }
@@ -212,7 +294,7 @@ func (r *ragServiceImpl) QueryRAG(c context.Context, req models.QueryTextRequest
 		Text: req.Query,
 	})
 
-	geminiAnswer, retrievedDocs, err := r.runAgenticLoop(c, session, initialParts)
+	geminiAnswer, retrievedDocs, err := r.runAgenticLoop(c, session, initialParts, req.Retrieval)
 	if err != nil {
 		return nil, fmt.Errorf("agentic loop failed: %w", err)
 	}
@@ -226,7 +308,8 @@ func (r *ragServiceImpl) QueryRAG(c context.Context, req models.QueryTextRequest
 }
 
 // runAgenticLoop is the core reasoning loop for the agent.
-func (r *ragServiceImpl) runAgenticLoop(c context.Context, chatSession *genai.Chat, initialParts []genai.Part) (string, []models.SourceDocument, error) {
+// Retrieval options from the request apply to every retrieveDocuments call it makes.
+func (r *ragServiceImpl) runAgenticLoop(c context.Context, chatSession *genai.Chat, initialParts []genai.Part, retrievalOpts models.RetrievalOptions) (string, []models.SourceDocument, error) {
 	log.Printf("AGENT-LOOP: Starting with %d initial parts...", len(initialParts))
 	var allRetrievedDocs []models.SourceDocument
 
@@ -253,7 +336,8 @@ func (r *ragServiceImpl) runAgenticLoop(c context.Context, chatSession *genai.Ch
 				if !ok {
 					toolResult = "Error: 'query' argument must be a string."
 				} else {
-					docs, err := r.retrieveDocuments(c, query, 3)
+					callOpts := optionsFromToolArgs(call.Args, retrievalOpts)
+					docs, err := r.retrieveDocuments(c, query, callOpts)
 					if err != nil {
 						toolResult = fmt.Sprintf("Error retrieving documents: %v", err)
 					} else {
@@ -312,12 +396,266 @@ func (r *ragServiceImpl) runAgenticLoop(c context.Context, chatSession *genai.Ch
 	}
 }
 
-// retrieveDocuments queries ChromaDB for similar documents using v2 API
-func (r *ragServiceImpl) retrieveDocuments(c context.Context, query string, nResults int) ([]models.SourceDocument, error) {
-	log.Printf("SERVICE-HELPER: Retrieving documents from ChromaDB using v2 API...")
+// retrieveDocuments runs a dense vector query against ChromaDB and a BM25
+// query against the local lexical index, then fuses both ranked lists with
+// reciprocal rank fusion. The fused candidates are optionally reranked and
+// diversified with MMR before the top opts.K are returned, optionally expanded
+// with their surrounding context.
+func (r *ragServiceImpl) retrieveDocuments(c context.Context, query string, opts models.RetrievalOptions) ([]models.SourceDocument, error) {
+	log.Printf("SERVICE-HELPER: Retrieving documents (hybrid vector + BM25)...")
+
+	k := opts.K
+	if k <= 0 {
+		k = defaultRetrievalK
+	}
+	k = min(k, maxRetrievalK)
+
+	vectorWeight := fusionWeight(opts.VectorWeight)
+	lexicalWeight := fusionWeight(opts.LexicalWeight)
+	if r.lexical == nil {
+		lexicalWeight = 0
+	}
+	if vectorWeight <= 0 && lexicalWeight <= 0 {
+		return nil, fmt.Errorf("at least one of vectorWeight and lexicalWeight must be positive")
+	}
+
+	var knownFiles []string
+	if r.lexical != nil {
+		knownFiles = r.lexical.SourceFiles()
+	}
+	filter, err := resolveFilter(opts.Filter, r.FileActions.NotesDir, knownFiles)
+	if err != nil {
+		return nil, err
+	}
+	if filter.matchesNothing() {
+		log.Printf("SERVICE-HELPER: No indexed files match the source_file/folder filter")
+		return []models.SourceDocument{}, nil
+	}
+
+	rerank := r.reranker != nil && (opts.Rerank == nil || *opts.Rerank)
+	useMMR := opts.MMR != nil && *opts.MMR
+
+	// Over-fetch from each retriever so fusion (and reranking / MMR) has
+	// overlap and alternatives to work with.
+	candidates := k * 4
+	if rerank {
+		candidates = max(candidates, r.rerankTopN)
+	}
+
+	var lists [][]retrievedChunk
+	var weights []float64
+	if vectorWeight > 0 {
+		vectorHits, err := r.vectorSearch(c, query, candidates, filter.where())
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, vectorHits)
+		weights = append(weights, vectorWeight)
+	}
+	if lexicalWeight > 0 {
+		var lexicalHits []retrievedChunk
+		for _, hit := range r.lexical.Search(query, candidates, filter.matches) {
+			lexicalHits = append(lexicalHits, retrievedChunk{ID: hit.ID, Text: hit.Text, Metadata: hit.Metadata})
+		}
+		lists = append(lists, lexicalHits)
+		weights = append(weights, lexicalWeight)
+	}
+
+	fused := reciprocalRankFusion(lists, weights)
+	if len(fused) > candidates {
+		fused = fused[:candidates]
+	}
+
+	if rerank {
+		fused = r.rerankChunks(c, query, fused)
+	}
+	if useMMR && len(fused) > k {
+		lambda := defaultMMRLambda
+		if opts.MMRLambda != nil {
+			lambda = *opts.MMRLambda
+		}
+		fused = r.diversifyChunks(c, fused, k, lambda)
+	}
+	if len(fused) > k {
+		fused = fused[:k]
+	}
+
+	documents := make([]models.SourceDocument, 0, len(fused))
+	for _, fc := range fused {
+		// Copy the metadata: lexical hits share their map with the index.
+		metadataMap := make(map[string]interface{}, len(fc.Metadata)+2)
+		for key, value := range fc.Metadata {
+			metadataMap[key] = value
+		}
+		metadataMap["rrf_score"] = fc.Score
+		if fc.RerankScore != nil {
+			metadataMap["rerank_score"] = *fc.RerankScore
+			metadataMap["reranker"] = r.reranker.Name()
+		}
+		documents = append(documents, newSourceDocument(fc.ID, fc.Text, metadataMap, fc.Distance, fc.rankingScore()))
+	}
+	if opts.Expand != "" {
+		documents = r.expandDocuments(c, documents, opts.Expand, opts.ExpandWindow)
+	}
+	if opts.ExpandLinks {
+		documents = r.expandLinkedNotes(c, query, documents, filter, k)
+	}
+	log.Printf("SERVICE-HELPER: Retrieved %d documents", len(documents))
+	return documents, nil
+}
+
+// rerankChunks rescores the top rerankTopN fused chunks with the reranker and
+// returns them sorted by that score. If the reranker fails, the fused order is
+// kept and no rerank scores are set.
+func (r *ragServiceImpl) rerankChunks(c context.Context, query string, fused []fusedChunk) []fusedChunk {
+	if len(fused) > r.rerankTopN {
+		fused = fused[:r.rerankTopN]
+	}
+	if len(fused) == 0 {
+		return fused
+	}
+
+	texts := make([]string, len(fused))
+	for i, fc := range fused {
+		texts[i] = fc.Text
+	}
+	scores, err := r.reranker.Rerank(c, query, texts)
+	if err == nil && len(scores) != len(fused) {
+		err = fmt.Errorf("got %d scores for %d chunks", len(scores), len(fused))
+	}
+	if err != nil {
+		log.Printf("WARN: Reranking with %s failed, keeping fused order: %v", r.reranker.Name(), err)
+		return fused
+	}
+
+	reranked := make([]fusedChunk, len(fused))
+	for i, fc := range fused {
+		score := scores[i]
+		fc.RerankScore = &score
+		reranked[i] = fc
+	}
+	sort.SliceStable(reranked, func(a, b int) bool {
+		return *reranked[a].RerankScore > *reranked[b].RerankScore
+	})
+	return reranked
+}
 
-	// 1. Embed the query text using Ollama
-	queryEmbedding, err := r.EmbedTextWithOllama(c, query)
+// diversifyChunks re-selects k chunks from candidates with Maximal Marginal
+// Relevance, using the chunk embeddings stored in Chroma. On failure the
+// candidates are returned unchanged.
+func (r *ragServiceImpl) diversifyChunks(c context.Context, candidates []fusedChunk, k int, lambda float64) []fusedChunk {
+	ids := make([]chromago.DocumentID, len(candidates))
+	for i, fc := range candidates {
+		ids[i] = chromago.DocumentID(fc.ID)
+	}
+	results, err := r.collection.Get(c,
+		chromago.WithIDsGet(ids...),
+		chromago.WithIncludeGet(chromago.IncludeEmbeddings),
+	)
+	if err != nil {
+		log.Printf("WARN: Could not load embeddings for MMR, keeping relevance order: %v", err)
+		return candidates
+	}
+	byID := make(map[string][]float32, results.Count())
+	embeddingList := results.GetEmbeddings()
+	for i, id := range results.GetIDs() {
+		if i < len(embeddingList) && embeddingList[i] != nil {
+			byID[string(id)] = embeddingList[i].ContentAsFloat32()
+		}
+	}
+
+	relevance := make([]float64, len(candidates))
+	vectors := make([][]float32, len(candidates))
+	for i, fc := range candidates {
+		relevance[i] = fc.rankingScore()
+		vectors[i] = byID[fc.ID]
+	}
+
+	selected := make([]fusedChunk, 0, k)
+	for _, idx := range mmrSelect(relevance, vectors, k, lambda) {
+		selected = append(selected, candidates[idx])
+	}
+	return selected
+}
+
+// optionsFromToolArgs reads the optional arguments of a retrieveDocuments call.
+// Arguments the model sets override the request-level options in base.
+func optionsFromToolArgs(args map[string]interface{}, base models.RetrievalOptions) models.RetrievalOptions {
+	opts := base
+	// Gemini sends JSON numbers, which arrive as float64.
+	if v, ok := args["k"].(float64); ok && v > 0 {
+		opts.K = int(v)
+	}
+	if v, ok := args["diversify"].(bool); ok {
+		opts.MMR = &v
+	}
+	if v, ok := args["expand"].(string); ok && (v == ExpandNeighbors || v == ExpandSection) {
+		opts.Expand = v
+	}
+	if v, ok := args["expand_links"].(bool); ok {
+		opts.ExpandLinks = v
+	}
+	opts.Filter = filterFromToolArgs(args, base.Filter)
+	return opts
+}
+
+// filterFromToolArgs reads the optional filter arguments of a retrieveDocuments
+// call. The filters the user set in base always hold: the model can only fill
+// the fields the request left empty, and add tags and field values to those
+// the user required, so it can narrow the user's scope but never widen it.
+func filterFromToolArgs(args map[string]interface{}, base models.RetrievalFilter) models.RetrievalFilter {
+	filter := base
+	if v, ok := args["source_file"].(string); ok && v != "" && filter.SourceFile == "" {
+		filter.SourceFile = v
+	}
+	if v, ok := args["folder"].(string); ok && v != "" && filter.Folder == "" {
+		filter.Folder = v
+	}
+	if v, ok := args["modified_after"].(string); ok && v != "" && filter.ModifiedAfter == "" {
+		filter.ModifiedAfter = v
+	}
+	if v, ok := args["modified_before"].(string); ok && v != "" && filter.ModifiedBefore == "" {
+		filter.ModifiedBefore = v
+	}
+	if raw, ok := args["tags"].([]interface{}); ok && len(raw) > 0 {
+		// Every tag must match, so adding the model's tags only narrows.
+		filter.Tags = append([]string{}, base.Tags...)
+		for _, t := range raw {
+			if tag, ok := t.(string); ok && !slices.Contains(filter.Tags, tag) {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+	if raw, ok := args["fields"].([]interface{}); ok && len(raw) > 0 {
+		filter.Fields = make(map[string]string, len(base.Fields)+len(raw))
+		for name, value := range base.Fields {
+			filter.Fields[name] = value
+		}
+		for _, f := range raw {
+			pair, _ := f.(string)
+			name, value, ok := strings.Cut(pair, "=")
+			name = strings.TrimSpace(name)
+			if _, set := base.Fields[name]; ok && name != "" && !set {
+				filter.Fields[name] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return filter
+}
+
+// fusionWeight resolves an optional per-query fusion weight, defaulting to 1.
+func fusionWeight(w *float64) float64 {
+	if w == nil {
+		return 1
+	}
+	return *w
+}
+
+// vectorSearch queries ChromaDB for the chunks closest to query using v2 API.
+// where may be nil for an unfiltered search.
+func (r *ragServiceImpl) vectorSearch(c context.Context, query string, nResults int, where chromago.WhereFilter) ([]retrievedChunk, error) {
+	// 1. Embed the query text with the configured embedder
+	queryEmbedding, err := r.embedder.Embed(c, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to embed query text: %w", err)
 	}
@@ -326,50 +664,120 @@ func (r *ragServiceImpl) retrieveDocuments(c context.Context, query string, nRes
 	embedding := embeddings.NewEmbeddingFromFloat32(queryEmbedding)
 
 	// 2. Use the query embedding to find similar documents in ChromaDB
-	results, err := r.collection.Query(
-		c,
+	queryOpts := []chromago.CollectionQueryOption{
 		chromago.WithQueryEmbeddings(embedding),
 		chromago.WithNResults(nResults),
-	)
+	}
+	if where != nil {
+		queryOpts = append(queryOpts, chromago.WithWhereQuery(where))
+	}
+	results, err := r.collection.Query(c, queryOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query chromadb: %w", err)
 	}
 
-	var documents []models.SourceDocument
+	var chunks []retrievedChunk
+	idGroups := results.GetIDGroups()
 	documentGroups := results.GetDocumentsGroups()
 	metadataGroups := results.GetMetadatasGroups()
+	distanceGroups := results.GetDistancesGroups()
 
 	if len(documentGroups) > 0 {
 		for i, doc := range documentGroups[0] {
-			if doc.ContentString() != "" {
-				metadata := metadataGroups[0][i]
-				var metadataMap map[string]interface{}
-
-				// THIS IS THE KEY: The DocumentMetadata struct does not have a public GetValues() method.
-				// The correct way to convert it to a map is to marshal it to JSON and then unmarshal it.
-				if metadata != nil {
-					jsonBytes, err := json.Marshal(metadata)
-					if err != nil {
-						log.Printf("WARN: could not marshal metadata for document: %v", err)
-						metadataMap = make(map[string]interface{}) // Use empty map on error
-					} else {
-						if err := json.Unmarshal(jsonBytes, &metadataMap); err != nil {
-							log.Printf("WARN: could not unmarshal metadata for document: %v", err)
-							metadataMap = make(map[string]interface{}) // Use empty map on error
-						}
-					}
-				}
-
-				sourceDoc := models.SourceDocument{
-					Text:     doc.ContentString(),
-					Metadata: metadataMap,
-				}
-				documents = append(documents, sourceDoc)
+			if doc.ContentString() == "" {
+				continue
 			}
+			var metadata chromago.DocumentMetadata
+			if len(metadataGroups) > 0 && i < len(metadataGroups[0]) {
+				metadata = metadataGroups[0][i]
+			}
+			var distance *float64
+			if len(distanceGroups) > 0 && i < len(distanceGroups[0]) {
+				d := float64(distanceGroups[0][i])
+				distance = &d
+			}
+			chunks = append(chunks, retrievedChunk{
+				ID:       string(idGroups[0][i]),
+				Text:     doc.ContentString(),
+				Metadata: metadataToMap(metadata),
+				Distance: distance,
+			})
 		}
 	}
-	log.Printf("SERVICE-HELPER: Retrieved %d documents", len(documents))
-	return documents, nil
+	return chunks, nil
+}
+
+// newSourceDocument builds the API representation of a retrieved chunk,
+// lifting its identity and position out of the metadata.
+func newSourceDocument(id, text string, metadata map[string]interface{}, distance *float64, score float64) models.SourceDocument {
+	sourceFile, _ := metadata["source_file"].(string)
+	pageStart, pageEnd := metadataInt(metadata, "page_start", 0), metadataInt(metadata, "page_end", 0)
+	return models.SourceDocument{
+		ID:         id,
+		Text:       text,
+		SourceFile: sourceFile,
+		ChunkNum:   metadataInt(metadata, "chunk_num", 0),
+		CharStart:  metadataInt(metadata, "char_start", -1),
+		CharEnd:    metadataInt(metadata, "char_end", -1),
+		PageStart:  pageStart,
+		PageEnd:    pageEnd,
+		Citation:   citation(sourceFile, pageStart, pageEnd),
+		Distance:   distance,
+		Score:      score,
+		Metadata:   metadata,
+	}
+}
+
+// citation formats a source as "file.pdf", "file.pdf p. 12" or
+// "file.pdf pp. 12-13".
+func citation(sourceFile string, pageStart, pageEnd int) string {
+	if sourceFile == "" {
+		return ""
+	}
+	name := filepath.Base(sourceFile)
+	switch {
+	case pageStart <= 0:
+		return name
+	case pageEnd <= pageStart:
+		return fmt.Sprintf("%s p. %d", name, pageStart)
+	default:
+		return fmt.Sprintf("%s pp. %d-%d", name, pageStart, pageEnd)
+	}
+}
+
+// metadataInt reads an integer metadata value. Values decoded from JSON are
+// float64, so both representations are accepted.
+func metadataInt(metadata map[string]interface{}, key string, fallback int) int {
+	switch v := metadata[key].(type) {
+	case float64:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return fallback
+	}
+}
+
+// metadataToMap converts Chroma document metadata into a plain map.
+// The DocumentMetadata struct does not have a public GetValues() method, so
+// the correct way to convert it is to marshal it to JSON and then unmarshal it.
+func metadataToMap(metadata chromago.DocumentMetadata) map[string]interface{} {
+	metadataMap := make(map[string]interface{})
+	if metadata == nil {
+		return metadataMap
+	}
+	jsonBytes, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("WARN: could not marshal metadata for document: %v", err)
+		return metadataMap
+	}
+	if err := json.Unmarshal(jsonBytes, &metadataMap); err != nil {
+		log.Printf("WARN: could not unmarshal metadata for document: %v", err)
+		return make(map[string]interface{})
+	}
+	return metadataMap
 }
 
 // generateResponseWithGemini generates a response using a Gemini Chat Session
@@ -406,7 +814,7 @@ func (r *ragServiceImpl) generateResponseWithGemini(c context.Context, chatSessi
 				if !ok {
 					toolResult = "Error: 'query' argument must be a string."
 				} else {
-					docs, err := r.retrieveDocuments(c, query, 3)
+					docs, err := r.retrieveDocuments(c, query, models.RetrievalOptions{})
 					if err != nil {
 						toolResult = fmt.Sprintf("Error retrieving documents: %v", err)
 					} else {
@@ -453,45 +861,20 @@ func (r *ragServiceImpl) generateResponseWithGemini(c context.Context, chatSessi
 	}
 }
 
-// EmbedTextWithOllama generates embeddings using Ollama.
-func (r *ragServiceImpl) EmbedTextWithOllama(c context.Context, textToEmbed string) ([]float32, error) {
-	reqBody, err := json.Marshal(models.OllamaEmbedRequest{
-		Model:  "nomic-embed-text:v1.5",
-		Prompt: textToEmbed,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal ollama request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(c, http.MethodPost, "http://localhost:11434/api/embeddings", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ollama http request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := r.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call ollama embedding api: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama api returned non-200 status: %d, body: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	var ollamaResp models.OllamaEmbedResponse
-	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
-		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
-	}
-	return ollamaResp.Embedding, nil
-}
-
 // NewRAGService creates a new RAG service instance
-func NewRAGService(client *http.Client, collection chromago.Collection, geminiClient *genai.Client, fileActions *FileActions) RAGService {
+// The link graph is used for link expansion and GET /links.
+// The reranker may be nil; when set, RERANK_CANDIDATES (default 20) chunks are
+// over-fetched and rescored before the top results are returned.
+func NewRAGService(client *http.Client, collection chromago.Collection, embedder Embedder, lexical *LexicalIndex, links *LinkGraph, manifest *IndexManifest, reranker Reranker, geminiClient *genai.Client, fileActions *FileActions) RAGService {
 	return &ragServiceImpl{
 		httpClient:   client,
 		collection:   collection, // No longer a pointer
+		embedder:     embedder,
+		lexical:      lexical,
+		links:        links,
+		manifest:     manifest,
+		reranker:     reranker,
+		rerankTopN:   envIntOrDefault("RERANK_CANDIDATES", 20),
 		geminiClient: geminiClient,
 		FileActions:  fileActions, // Initialize FileActions
 		chatSessions: make(map[string]*genai.Chat),
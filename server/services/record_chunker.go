@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// recordChunker indexes each record of a structured-data file (a block of
+// "key: value" lines, see extractTextFromStructured) as one chunk, however
+// large, and keeps its field values for the chunk metadata. Records longer
+// than the embedding model accepts are still split by enforceTokenLimit.
+type recordChunker struct {
+	spec    ChunkerSpec
+	lenFunc func(string) int
+	params  string
+}
+
+func (c *recordChunker) Chunk(_, content string) ([]TextChunk, error) {
+	var chunks []TextChunk
+	offset := 0 // rune offset of the current line
+	var record []string
+	start := 0
+	flush := func() {
+		if len(record) == 0 {
+			return
+		}
+		text := strings.Join(record, "\n")
+		chunks = append(chunks, TextChunk{
+			Text:   text,
+			Start:  start,
+			End:    start + utf8.RuneCountInString(text),
+			Fields: parseRecordFields(record),
+		})
+		record = nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			flush()
+		} else {
+			if len(record) == 0 {
+				start = offset
+			}
+			record = append(record, line)
+		}
+		offset += utf8.RuneCountInString(line) + 1
+	}
+	flush()
+	return chunks, nil
+}
+
+func (c *recordChunker) Name() string   { return "records" }
+func (c *recordChunker) Params() string { return c.params }
+
+// parseRecordFields reads the "key: value" lines of a record. Lines without
+// a key are ignored.
+func parseRecordFields(lines []string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
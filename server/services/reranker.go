@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github/itish2003/rag/models"
+
+	"google.golang.org/genai"
+)
+
+// Reranker rescores retrieved chunks against the query. It sees the query and
+// each chunk together, so it can judge relevance more precisely than the
+// independent embeddings used for the first-stage search.
+type Reranker interface {
+	// Rerank returns one relevance score per document, in input order. Higher is better.
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+	// Name identifies the reranker in logs and result metadata.
+	Name() string
+}
+
+// NewRerankerFromEnv picks a Reranker based on RERANKER. Supported values are
+// "cross-encoder" (an HTTP rerank server at RERANKER_URL), "llm" (Gemini
+// scoring) and "" / "none", which disables reranking and returns nil.
+func NewRerankerFromEnv(httpClient *http.Client, geminiClient *genai.Client) (Reranker, error) {
+	switch strings.ToLower(os.Getenv("RERANKER")) {
+	case "", "none":
+		return nil, nil
+	case "cross-encoder":
+		url := os.Getenv("RERANKER_URL")
+		if url == "" {
+			return nil, fmt.Errorf("RERANKER_URL must be set for the cross-encoder reranker")
+		}
+		return NewCrossEncoderReranker(httpClient, url), nil
+	case "llm":
+		return NewLLMReranker(geminiClient, envOrDefault("RERANKER_MODEL", "gemini-2.5-flash")), nil
+	default:
+		return nil, fmt.Errorf("unknown RERANKER %q", os.Getenv("RERANKER"))
+	}
+}
+
+// crossEncoderReranker calls a cross-encoder served over HTTP using the
+// text-embeddings-inference /rerank API (also implemented by Infinity and others).
+type crossEncoderReranker struct {
+	httpClient *http.Client
+	url        string
+}
+
+// NewCrossEncoderReranker creates a Reranker that POSTs to the rerank endpoint at url.
+func NewCrossEncoderReranker(httpClient *http.Client, url string) Reranker {
+	return &crossEncoderReranker{httpClient: httpClient, url: url}
+}
+
+func (r *crossEncoderReranker) Name() string {
+	return "cross-encoder"
+}
+
+func (r *crossEncoderReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var results []models.RerankResult
+	err := postJSON(ctx, r.httpClient, r.url, "", models.RerankRequest{
+		Query: query,
+		Texts: documents,
+	}, &results)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+
+	// Results may come back sorted by score, so they are mapped by index; every
+	// input must be scored exactly once or the scores can't be trusted.
+	if len(results) != len(documents) {
+		return nil, fmt.Errorf("rerank server returned %d scores for %d texts", len(results), len(documents))
+	}
+	scores := make([]float64, len(documents))
+	scored := make([]bool, len(documents))
+	for _, res := range results {
+		if res.Index < 0 || res.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank server returned out-of-range index %d", res.Index)
+		}
+		if scored[res.Index] {
+			return nil, fmt.Errorf("rerank server returned index %d twice", res.Index)
+		}
+		scores[res.Index], scored[res.Index] = res.Score, true
+	}
+	return scores, nil
+}
+
+// llmReranker asks a Gemini model to grade each chunk's relevance.
+type llmReranker struct {
+	geminiClient *genai.Client
+	model        string
+}
+
+// NewLLMReranker creates a Reranker that scores chunks with the given Gemini model.
+func NewLLMReranker(geminiClient *genai.Client, model string) Reranker {
+	return &llmReranker{geminiClient: geminiClient, model: model}
+}
+
+func (r *llmReranker) Name() string {
+	return "llm:" + r.model
+}
+
+func (r *llmReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Rate how relevant each passage is to the query on a scale from 0 (irrelevant) to 10 (answers it directly).\n")
+	fmt.Fprintf(&prompt, "Respond with a JSON array of exactly %d numbers, one per passage, in order.\n\n", len(documents))
+	fmt.Fprintf(&prompt, "Query: %s\n", query)
+	for i, doc := range documents {
+		fmt.Fprintf(&prompt, "\nPassage %d:\n%s\n", i+1, doc)
+	}
+
+	result, err := r.geminiClient.Models.GenerateContent(ctx, r.model, genai.Text(prompt.String()), &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type:  genai.TypeArray,
+			Items: &genai.Schema{Type: genai.TypeNumber},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("llm rerank call failed: %w", err)
+	}
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(result.Text()), &scores); err != nil {
+		return nil, fmt.Errorf("could not parse llm rerank scores: %w", err)
+	}
+	if len(scores) != len(documents) {
+		return nil, fmt.Errorf("llm returned %d scores for %d passages", len(scores), len(documents))
+	}
+	return scores, nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github/itish2003/rag/models"
+
+	chromago "github.com/amikos-tech/chroma-go/pkg/api/v2"
+)
+
+// tagMetadataKey is the metadata key marking a chunk as carrying tag. Chroma
+// metadata has no list type, so each tag is stored as its own boolean attribute.
+func tagMetadataKey(tag string) string {
+	return "tag_" + strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// maxFieldValueRunes is the longest record field value stored as metadata.
+const maxFieldValueRunes = 200
+
+// fieldKeyRegex matches the characters of a field name not used in its metadata key.
+var fieldKeyRegex = regexp.MustCompile(`[^\p{L}\p{N}_]+`)
+
+// fieldMetadataKey is the metadata key holding a structured-data record's
+// value for field name, e.g. "field_author_name" for "author.name".
+func fieldMetadataKey(name string) string {
+	return "field_" + strings.Trim(fieldKeyRegex.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// inlineTagRegex matches Obsidian-style #tags. A tag must contain at least one
+// non-digit, and "# Heading" is not a tag because of the space.
+var inlineTagRegex = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+
+// extractInlineTags returns the distinct #tags in markdown text, skipping fenced code blocks.
+func extractInlineTags(text string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		for _, m := range inlineTagRegex.FindAllStringSubmatch(line, -1) {
+			tag := strings.ToLower(m[1])
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// resolvedFilter is a models.RetrievalFilter with globs and folder prefixes
+// expanded to the concrete set of indexed files and dates parsed to Unix time.
+type resolvedFilter struct {
+	files          map[string]bool // nil means no file restriction
+	tags           []string
+	fields         map[string]string // metadata key -> required value
+	modifiedAfter  int64             // 0 means unset
+	modifiedBefore int64             // 0 means unset
+}
+
+// ValidateRetrievalFilter checks the parts of a filter that can be wrong on
+// their own (dates and glob syntax), so callers can reject bad input early.
+func ValidateRetrievalFilter(f models.RetrievalFilter) error {
+	if f.SourceFile != "" {
+		if _, err := filepath.Match(f.SourceFile, ""); err != nil {
+			return fmt.Errorf("invalid source_file pattern %q: %w", f.SourceFile, err)
+		}
+	}
+	if _, err := parseFilterDate(f.ModifiedAfter, false); err != nil {
+		return fmt.Errorf("invalid modified_after: %w", err)
+	}
+	if _, err := parseFilterDate(f.ModifiedBefore, true); err != nil {
+		return fmt.Errorf("invalid modified_before: %w", err)
+	}
+	return nil
+}
+
+// resolveFilter expands f against the known indexed files. Relative globs and
+// folders are interpreted relative to notesDir.
+func resolveFilter(f models.RetrievalFilter, notesDir string, knownFiles []string) (*resolvedFilter, error) {
+	if err := ValidateRetrievalFilter(f); err != nil {
+		return nil, err
+	}
+	rf := &resolvedFilter{}
+	rf.modifiedAfter, _ = parseFilterDate(f.ModifiedAfter, false)
+	rf.modifiedBefore, _ = parseFilterDate(f.ModifiedBefore, true)
+	for _, tag := range f.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			rf.tags = append(rf.tags, tag)
+		}
+	}
+	for name, value := range f.Fields {
+		if rf.fields == nil {
+			rf.fields = make(map[string]string)
+		}
+		rf.fields[fieldMetadataKey(name)] = value
+	}
+
+	if f.SourceFile == "" && f.Folder == "" {
+		return rf, nil
+	}
+
+	folder := f.Folder
+	if folder != "" && !filepath.IsAbs(folder) && notesDir != "" {
+		folder = filepath.Join(notesDir, folder)
+	}
+	folder = filepath.Clean(folder)
+
+	rf.files = make(map[string]bool)
+	for _, path := range knownFiles {
+		if f.Folder != "" && !strings.HasPrefix(path, folder+string(filepath.Separator)) {
+			continue
+		}
+		if f.SourceFile != "" && !matchSourceGlob(f.SourceFile, path, notesDir) {
+			continue
+		}
+		rf.files[path] = true
+	}
+	return rf, nil
+}
+
+// matchSourceGlob matches pattern against the absolute path, the path relative
+// to notesDir, and (for patterns without a separator) the file name.
+func matchSourceGlob(pattern, path, notesDir string) bool {
+	candidates := []string{path}
+	if notesDir != "" {
+		if rel, err := filepath.Rel(notesDir, path); err == nil {
+			candidates = append(candidates, rel)
+		}
+	}
+	if !strings.ContainsRune(pattern, filepath.Separator) {
+		candidates = append(candidates, filepath.Base(path))
+	}
+	for _, c := range candidates {
+		if ok, _ := filepath.Match(pattern, c); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilterDate accepts RFC 3339 timestamps or YYYY-MM-DD dates (local time).
+// A bare date used as an upper bound covers the whole day.
+func parseFilterDate(value string, endOfDay bool) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a YYYY-MM-DD date or RFC 3339 timestamp", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t.Unix(), nil
+}
+
+// matchesNothing reports whether a file restriction was given but no indexed file satisfies it.
+func (rf *resolvedFilter) matchesNothing() bool {
+	return rf.files != nil && len(rf.files) == 0
+}
+
+// where translates the filter into a Chroma where clause, or nil if it is empty.
+func (rf *resolvedFilter) where() chromago.WhereFilter {
+	return whereAll(rf.clauses())
+}
+
+// whereAll joins clauses into one where clause, or nil if there are none.
+// Chroma rejects an $and with fewer than two operands, so a single clause is
+// returned as is.
+func whereAll(clauses []chromago.WhereClause) chromago.WhereFilter {
+	switch len(clauses) {
+	case 0:
+		return nil
+	case 1:
+		return clauses[0]
+	default:
+		return chromago.And(clauses...)
+	}
+}
+
+// clauses returns one Chroma where clause per condition of the filter.
+func (rf *resolvedFilter) clauses() []chromago.WhereClause {
+	var clauses []chromago.WhereClause
+	if len(rf.files) > 0 {
+		files := make([]string, 0, len(rf.files))
+		for path := range rf.files {
+			files = append(files, path)
+		}
+		sort.Strings(files)
+		clauses = append(clauses, chromago.InString("source_file", files...))
+	}
+	for _, tag := range rf.tags {
+		clauses = append(clauses, chromago.EqBool(tagMetadataKey(tag), true))
+	}
+	keys := make([]string, 0, len(rf.fields))
+	for key := range rf.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		clauses = append(clauses, chromago.EqString(key, rf.fields[key]))
+	}
+	if rf.modifiedAfter != 0 {
+		clauses = append(clauses, chromago.GteInt("modified_at", int(rf.modifiedAfter)))
+	}
+	if rf.modifiedBefore != 0 {
+		clauses = append(clauses, chromago.LteInt("modified_at", int(rf.modifiedBefore)))
+	}
+	return clauses
+}
+
+// matches applies the same filter to a chunk's metadata in Go, for retrievers
+// (like BM25) that don't go through Chroma.
+func (rf *resolvedFilter) matches(metadata map[string]interface{}) bool {
+	if rf.files != nil {
+		path, _ := metadata["source_file"].(string)
+		if !rf.files[path] {
+			return false
+		}
+	}
+	for _, tag := range rf.tags {
+		if v, _ := metadata[tagMetadataKey(tag)].(bool); !v {
+			return false
+		}
+	}
+	for key, want := range rf.fields {
+		if v, _ := metadata[key].(string); v != want {
+			return false
+		}
+	}
+	if rf.modifiedAfter != 0 || rf.modifiedBefore != 0 {
+		modified := int64(metadataInt(metadata, "modified_at", 0))
+		if rf.modifiedAfter != 0 && modified < rf.modifiedAfter {
+			return false
+		}
+		if rf.modifiedBefore != 0 && modified > rf.modifiedBefore {
+			return false
+		}
+	}
+	return true
+}
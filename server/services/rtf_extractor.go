@@ -0,0 +1,228 @@
+package services
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// rtfSkipDestinations are groups whose content is not document text.
+var rtfSkipDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "info": true, "pict": true, "object": true,
+	"header": true, "headerl": true, "headerr": true, "headerf": true,
+	"footer": true, "footerl": true, "footerr": true, "footerf": true,
+	"footnote": true, "fldinst": true, "themedata": true, "colorschememapping": true,
+	"datastore": true, "latentstyles": true, "listtable": true, "listoverridetable": true,
+	"rsidtbl": true, "generator": true, "xmlnstbl": true, "mmathPr": true,
+	"pgdsctbl": true, "revtbl": true, "filetbl": true, "listtext": true, "pntext": true,
+}
+
+// rtfSymbols maps control words that stand for a single character.
+var rtfSymbols = map[string]string{
+	"tab": "\t", "line": "\n", "emdash": "—", "endash": "–", "bullet": "•",
+	"lquote": "‘", "rquote": "’", "ldblquote": "“", "rdblquote": "”",
+	"emspace": " ", "enspace": " ", "qmspace": " ",
+}
+
+// rtfHeadingStyleRegex matches stylesheet names of heading styles.
+var rtfHeadingStyleRegex = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+// extractTextFromRTF reads an RTF document. Paragraphs whose style is a
+// "heading N" style, or that carry an \outlinelevel, become markdown "#" lines.
+func extractTextFromRTF(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return parseRTF(string(data)), nil
+}
+
+// rtfGroup is the parser state saved and restored by { and }.
+type rtfGroup struct {
+	skip        bool   // inside a destination that produces no text
+	destination string // "stylesheet" while inside the style sheet
+	uc          int    // fallback characters to skip after \u
+}
+
+// parseRTF converts RTF source to text.
+func parseRTF(src string) string {
+	var out, para, styleName strings.Builder
+	state := rtfGroup{uc: 1}
+	var stack []rtfGroup
+	headingStyles := make(map[int]int) // style number -> heading level
+	style, outline := 0, -1            // current paragraph's \s and \outlinelevel
+	styleNum := 0                      // style being defined in the style sheet
+	skipChars := 0                     // \u fallback characters still to skip
+	firstInGroup := false              // whether the next token opens the group
+
+	flushParagraph := func() {
+		text := strings.TrimSpace(para.String())
+		para.Reset()
+		if text == "" {
+			return
+		}
+		level := headingStyles[style]
+		if outline >= 0 {
+			level = outline + 1
+		}
+		if level > 0 {
+			out.WriteString(strings.Repeat("#", min(level, 6)) + " ") // markdown has six levels
+		}
+		out.WriteString(text + "\n\n")
+	}
+	emit := func(s string) {
+		if skipChars > 0 {
+			skipChars--
+			return
+		}
+		switch {
+		case state.destination == "stylesheet":
+			styleName.WriteString(s)
+		case !state.skip:
+			para.WriteString(s)
+		}
+	}
+
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		opensGroup := firstInGroup
+		firstInGroup = false
+		switch ch {
+		case '{':
+			stack = append(stack, state)
+			firstInGroup = true
+			if state.destination == "stylesheet" {
+				styleNum = 0 // a style without \s is style 0
+			}
+		case '}':
+			if state.destination == "stylesheet" && styleName.Len() > 0 {
+				recordRTFStyle(headingStyles, styleNum, styleName.String())
+				styleName.Reset()
+			}
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case '\r', '\n':
+		case '\\':
+			if i+1 >= len(src) {
+				break
+			}
+			next := src[i+1]
+			if !isASCIILetter(next) {
+				i++
+				switch next {
+				case '\\', '{', '}':
+					emit(string(next))
+				case '\'':
+					if i+2 < len(src) {
+						if b, err := strconv.ParseUint(src[i+1:i+3], 16, 8); err == nil {
+							emit(string(charmap.Windows1252.DecodeByte(byte(b))))
+						}
+						i += 2
+					}
+				case '*':
+					state.skip = true
+				case '~':
+					emit(" ")
+				case '_':
+					emit("-")
+				case '\n', '\r':
+					flushParagraph()
+				}
+				break
+			}
+
+			// A control word: letters, an optional signed number, and an
+			// optional space delimiter that belongs to the word.
+			j := i + 1
+			for j < len(src) && isASCIILetter(src[j]) {
+				j++
+			}
+			word := src[i+1 : j]
+			k := j
+			if k < len(src) && src[k] == '-' {
+				k++
+			}
+			for k < len(src) && src[k] >= '0' && src[k] <= '9' {
+				k++
+			}
+			param, hasParam := 0, k > j
+			if hasParam {
+				param, _ = strconv.Atoi(src[j:k])
+			}
+			if k < len(src) && src[k] == ' ' {
+				k++
+			}
+			i = k - 1
+
+			switch {
+			case opensGroup && rtfSkipDestinations[word]:
+				state.skip = true
+			case opensGroup && word == "stylesheet":
+				state.skip = true
+				state.destination = "stylesheet"
+			case word == "par" || word == "sect" || word == "page":
+				flushParagraph()
+			case word == "pard":
+				style, outline = 0, -1
+			case word == "s":
+				if state.destination == "stylesheet" {
+					styleNum = param
+				} else {
+					style = param
+				}
+			case word == "outlinelevel":
+				if param >= 0 && param < 9 { // Word's outline levels are 0-8
+					outline = param
+				}
+			case word == "uc":
+				state.uc = param
+			case word == "u":
+				if param < 0 {
+					param += 65536
+				}
+				emit(string(rune(param)))
+				skipChars = state.uc
+			case word == "bin" && hasParam:
+				// Skip the binary data, ignoring bogus lengths that would move
+				// backwards or past the end.
+				if param > 0 {
+					i = min(i+param, len(src)-1)
+				}
+			default:
+				if sym, ok := rtfSymbols[word]; ok {
+					emit(sym)
+				}
+			}
+		default:
+			if state.destination == "stylesheet" && ch == ';' {
+				recordRTFStyle(headingStyles, styleNum, styleName.String())
+				styleName.Reset()
+				continue
+			}
+			if ch >= 0x80 {
+				// Raw 8-bit text is not valid RTF, but some writers emit it.
+				emit(string(charmap.Windows1252.DecodeByte(ch)))
+			} else {
+				emit(string(ch))
+			}
+		}
+	}
+	flushParagraph()
+	return strings.TrimSpace(out.String())
+}
+
+// recordRTFStyle remembers style num as a heading if its name is "heading N".
+func recordRTFStyle(headingStyles map[int]int, num int, name string) {
+	if m := rtfHeadingStyleRegex.FindStringSubmatch(strings.TrimSpace(name)); m != nil {
+		headingStyles[num], _ = strconv.Atoi(m[1])
+	}
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// structuredExtensions are the structured-data files indexed record by record.
+var structuredExtensions = map[string]bool{
+	".csv": true, ".json": true, ".jsonl": true, ".yaml": true, ".yml": true,
+}
+
+// recordField is one "key: value" line of a structured-data record. Nested
+// keys are joined with dots ("author.name").
+type recordField struct {
+	Key   string
+	Value string
+}
+
+// orderedObject is a JSON or YAML mapping with its key order preserved, so
+// records read in the order their author wrote them.
+type orderedObject []objectEntry
+
+type objectEntry struct {
+	Key   string
+	Value interface{}
+}
+
+// extractTextFromStructured turns a CSV, JSON, JSONL or YAML file into
+// self-describing text: one "key: value" line per field and a blank line
+// between records. The records chunker indexes each record as one chunk.
+func extractTextFromStructured(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	var records [][]recordField
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		records, err = parseCSVRecords(data)
+	case ".json":
+		var value interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if value, err = decodeJSONValue(dec); err == nil {
+			records = recordsFromValue(value)
+		}
+	case ".jsonl":
+		records, err = parseJSONLRecords(data)
+	case ".yaml", ".yml":
+		records, err = parseYAMLRecords(data)
+	default:
+		return "", fmt.Errorf("unsupported structured file type: %s", ext)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return renderRecords(records), nil
+}
+
+// renderRecords writes records as blocks of "key: value" lines. Values are
+// collapsed onto one line so a blank line always separates two records.
+func renderRecords(records [][]recordField) string {
+	var blocks []string
+	for _, fields := range records {
+		var lines []string
+		for _, f := range fields {
+			if value := strings.Join(strings.Fields(f.Value), " "); value != "" {
+				lines = append(lines, f.Key+": "+value)
+			}
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// parseCSVRecords reads a CSV file whose first row names the columns.
+func parseCSVRecords(data []byte) ([][]recordField, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records [][]recordField
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := make([]recordField, 0, len(row))
+		for i, value := range row {
+			key := ""
+			if i < len(header) {
+				key = strings.TrimSpace(header[i])
+			}
+			if key == "" {
+				key = "column_" + strconv.Itoa(i+1)
+			}
+			fields = append(fields, recordField{Key: key, Value: value})
+		}
+		records = append(records, fields)
+	}
+}
+
+// parseJSONLRecords reads one JSON value per line, skipping blank lines.
+func parseJSONLRecords(data []byte) ([][]recordField, error) {
+	var records [][]recordField
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.UseNumber()
+		value, err := decodeJSONValue(dec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, recordFields(value)...)
+	}
+	return records, scanner.Err()
+}
+
+// parseYAMLRecords reads every document of a YAML stream.
+func parseYAMLRecords(data []byte) ([][]recordField, error) {
+	var records [][]recordField
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := yamlValue(&doc)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recordsFromValue(value)...)
+	}
+}
+
+// recordsFromValue splits a decoded document into records. A top-level list
+// yields one record per item, as does an object wrapping a single list of
+// objects ({"books": [...]}); any other value is one record.
+func recordsFromValue(value interface{}) [][]recordField {
+	if obj, ok := value.(orderedObject); ok && len(obj) == 1 {
+		if items, ok := obj[0].Value.([]interface{}); ok && allObjects(items) {
+			value = items
+		}
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return recordFields(value)
+	}
+	var records [][]recordField
+	for _, item := range items {
+		records = append(records, recordFields(item)...)
+	}
+	return records
+}
+
+// recordFields flattens one value into a single record. A bare scalar becomes
+// a "value" field.
+func recordFields(value interface{}) [][]recordField {
+	key := ""
+	if _, ok := value.(orderedObject); !ok {
+		key = "value"
+	}
+	var fields []recordField
+	flattenValue(key, value, &fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	return [][]recordField{fields}
+}
+
+// flattenValue appends the fields of value under key. Objects nest with dots,
+// lists of scalars are joined with commas and lists of objects are numbered.
+func flattenValue(key string, value interface{}, fields *[]recordField) {
+	join := func(sub string) string {
+		if key == "" {
+			return sub
+		}
+		return key + "." + sub
+	}
+	switch v := value.(type) {
+	case orderedObject:
+		for _, entry := range v {
+			flattenValue(join(entry.Key), entry.Value, fields)
+		}
+	case []interface{}:
+		if !allScalars(v) {
+			for i, item := range v {
+				flattenValue(join(strconv.Itoa(i+1)), item, fields)
+			}
+			return
+		}
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := scalarString(item); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		*fields = append(*fields, recordField{Key: key, Value: strings.Join(parts, ", ")})
+	default:
+		*fields = append(*fields, recordField{Key: key, Value: scalarString(v)})
+	}
+}
+
+func allObjects(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(orderedObject); !ok {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+func allScalars(items []interface{}) bool {
+	for _, item := range items {
+		switch item.(type) {
+		case orderedObject, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// decodeJSONValue reads the next JSON value from dec, keeping object keys in
+// order. Numbers are json.Number when dec.UseNumber is set.
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch delim := tok.(type) {
+	case json.Delim:
+		switch delim {
+		case '{':
+			var obj orderedObject
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				value, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, objectEntry{Key: key, Value: value})
+			}
+			_, err := dec.Token() // closing }
+			return obj, err
+		case '[':
+			items := []interface{}{}
+			for dec.More() {
+				value, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, value)
+			}
+			_, err := dec.Token() // closing ]
+			return items, err
+		}
+		return nil, fmt.Errorf("unexpected %v", delim)
+	default:
+		return tok, nil
+	}
+}
+
+// maxYAMLAliasNodes caps how many nodes alias expansion may produce in one
+// document, so a "billion laughs" file cannot exhaust memory. yaml.v3 only
+// guards against that when decoding into Go values, not when walking nodes.
+const maxYAMLAliasNodes = 100000
+
+// yamlValue converts a YAML node to the values decodeJSONValue produces.
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	expanded := 0
+	return yamlNodeValue(n, false, &expanded)
+}
+
+// yamlNodeValue converts n, counting in expanded the nodes it visits through
+// an alias.
+func yamlNodeValue(n *yaml.Node, aliased bool, expanded *int) (interface{}, error) {
+	if aliased {
+		if *expanded++; *expanded > maxYAMLAliasNodes {
+			return nil, fmt.Errorf("yaml aliases expand to more than %d nodes", maxYAMLAliasNodes)
+		}
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeValue(n.Content[0], aliased, expanded)
+	case yaml.MappingNode:
+		obj := make(orderedObject, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			value, err := yamlNodeValue(n.Content[i+1], aliased, expanded)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, objectEntry{Key: n.Content[i].Value, Value: value})
+		}
+		return obj, nil
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			value, err := yamlNodeValue(c, aliased, expanded)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case yaml.AliasNode:
+		if n.Alias != nil {
+			return yamlNodeValue(n.Alias, true, expanded)
+		}
+		return nil, nil
+	default:
+		if n.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		return n.Value, nil
+	}
+}
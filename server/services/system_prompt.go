@@ -1,6 +1,11 @@
 package services
 
-import "google.golang.org/genai"
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/genai"
+)
 
 // GetSystemPrompt defines the core instructions for the AI agent.
 func GetSystemPrompt() *genai.Content {
@@ -11,9 +16,11 @@ You have access to a powerful set of tools to answer user requests. Your primary
 2.  **Document Retrieval**: You can search the user's notes for specific information using the 'retrieveDocuments' tool. You should use this tool whenever the user asks a question that requires knowledge from their notes (e.g., "Summarize my notes on X", "What did I write about Y?").
 3.  **File Management**: You can create, edit, and delete markdown files in the user's notes directory using the 'createMarkdownFile', 'editMarkdownFile', and 'deleteMarkdownFile' tools. You should use these when the user explicitly asks you to perform a file operation.
 
-Always think step-by-step. If a user's request requires information from their notes, your first step should be to call the 'retrieveDocuments' function with a clear and concise search query. Do not invent information. If you don't know the answer, say so.`
+Always think step-by-step. If a user's request requires information from their notes, your first step should be to call the 'retrieveDocuments' function with a clear and concise search query. Do not invent information. If you don't know the answer, say so. When you use a retrieved document, cite it by its 'citation' (e.g. "report.pdf p. 12").
+
+'retrieveDocuments' also accepts optional filters: 'folder', 'source_file' (a glob), 'tags', 'fields' (name=value pairs matched against CSV, JSON and YAML records), and 'modified_after' / 'modified_before' dates. Use them when the user scopes a question, e.g. "in my work folder" or "last month". Set 'expand_links' to pull in notes connected by [[wikilinks]] when a topic spans several linked notes. Today's date is %s.`
 
-	contents := genai.Text(prompt)
+	contents := genai.Text(fmt.Sprintf(prompt, time.Now().Format("2006-01-02 (Monday)")))
 	if len(contents) == 0 {
 		return nil
 	}
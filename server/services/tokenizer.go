@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Tokenizer counts model tokens locally, so chunks can be sized to the
+// embedding model's context window without calling the model.
+type Tokenizer interface {
+	// Count returns the number of tokens in text, excluding special tokens.
+	Count(text string) int
+	Name() string
+}
+
+// embeddingSpecialTokens is added to Count when checking a chunk against the
+// embedder's input limit ([CLS] and [SEP] for BERT-style models).
+const embeddingSpecialTokens = 2
+
+// embeddingTokenLimits is the maximum input length of common embedding
+// models, keyed by model name without its tag. Ollama runs nomic-embed-text
+// with a 2048-token context by default even though the model supports 8192.
+var embeddingTokenLimits = map[string]int{
+	"nomic-embed-text":       2048,
+	"mxbai-embed-large":      512,
+	"all-minilm":             256,
+	"snowflake-arctic-embed": 512,
+	"bge-large":              512,
+	"bge-m3":                 8192,
+	"text-embedding-3-small": 8191,
+	"text-embedding-3-large": 8191,
+	"text-embedding-ada-002": 8191,
+}
+
+// NewTokenizerFromEnv loads a WordPiece tokenizer from the vocab.txt named by
+// TOKENIZER_VOCAB (nomic-embed-text, mxbai-embed-large and all-minilm all use
+// BERT's WordPiece vocabulary). Without it, token counts are estimated.
+func NewTokenizerFromEnv() (Tokenizer, error) {
+	path := os.Getenv("TOKENIZER_VOCAB")
+	if path == "" {
+		return approxTokenizer{}, nil
+	}
+	return NewWordPieceTokenizer(path)
+}
+
+// maxEmbeddingTokens returns the input limit of model from EMBED_MAX_TOKENS or
+// the built-in table, or 0 if it is unknown (no limit is enforced).
+func maxEmbeddingTokens(model string) int {
+	name, _, _ := strings.Cut(model, ":")
+	name = strings.ToLower(name[strings.LastIndex(name, "/")+1:])
+	return envIntOrDefault("EMBED_MAX_TOKENS", embeddingTokenLimits[name])
+}
+
+// approxTokenCount estimates the number of model tokens in text: every
+// punctuation mark counts as one, and every word as one per four characters.
+func approxTokenCount(text string) int {
+	count, wordLen := 0, 0
+	endWord := func() {
+		if wordLen > 0 {
+			count += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			wordLen++
+		case unicode.IsSpace(r):
+			endWord()
+		default:
+			endWord()
+			count++
+		}
+	}
+	endWord()
+	return count
+}
+
+// approxTokenizer estimates token counts with approxTokenCount.
+type approxTokenizer struct{}
+
+func (approxTokenizer) Count(text string) int { return approxTokenCount(text) }
+func (approxTokenizer) Name() string          { return "approx" }
+
+// wordPieceTokenizer implements BERT's tokenization: basic whitespace and
+// punctuation splitting followed by greedy longest-match WordPiece.
+type wordPieceTokenizer struct {
+	vocab     map[string]bool
+	lowercase bool
+}
+
+// maxWordPieceRunes is the length above which BERT maps a word to [UNK].
+const maxWordPieceRunes = 100
+
+// NewWordPieceTokenizer loads a vocab.txt with one token per line. Vocabularies
+// without uppercase tokens are treated as uncased, which lowercases input and
+// strips accents.
+func NewWordPieceTokenizer(path string) (Tokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open tokenizer vocab %s: %w", path, err)
+	}
+	defer file.Close()
+
+	t := &wordPieceTokenizer{vocab: make(map[string]bool), lowercase: true}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		token := strings.TrimRight(scanner.Text(), "\r")
+		if token == "" {
+			continue
+		}
+		t.vocab[token] = true
+		if !strings.HasPrefix(token, "[") && strings.ToLower(token) != token {
+			t.lowercase = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read tokenizer vocab %s: %w", path, err)
+	}
+	if len(t.vocab) == 0 {
+		return nil, fmt.Errorf("tokenizer vocab %s is empty", path)
+	}
+	log.Printf("Loaded WordPiece vocabulary with %d tokens from %s (lowercase=%t).", len(t.vocab), path, t.lowercase)
+	return t, nil
+}
+
+func (t *wordPieceTokenizer) Name() string { return "wordpiece" }
+
+func (t *wordPieceTokenizer) Count(text string) int {
+	if t.lowercase {
+		text = stripAccents(strings.ToLower(text))
+	}
+	count := 0
+	for _, word := range basicTokenize(text) {
+		count += t.wordPieces(word)
+	}
+	return count
+}
+
+// wordPieces returns how many vocabulary pieces word splits into, or 1 if it
+// can't be split ([UNK]).
+func (t *wordPieceTokenizer) wordPieces(word string) int {
+	runes := []rune(word)
+	if len(runes) > maxWordPieceRunes {
+		return 1
+	}
+	pieces := 0
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if t.vocab[piece] {
+				break
+			}
+		}
+		if end == start {
+			return 1
+		}
+		pieces++
+		start = end
+	}
+	return pieces
+}
+
+// basicTokenize splits text on whitespace and isolates punctuation and CJK
+// characters, as BERT's BasicTokenizer does.
+func basicTokenize(text string) []string {
+	var words []string
+	var current strings.Builder
+	endWord := func() {
+		if current.Len() > 0 {
+			words = append(words, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r) || unicode.IsControl(r):
+			endWord()
+		case isBertPunct(r) || unicode.Is(unicode.Han, r):
+			endWord()
+			words = append(words, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	endWord()
+	return words
+}
+
+// isBertPunct treats all non-alphanumeric ASCII symbols as punctuation, plus
+// the Unicode punctuation categories.
+func isBertPunct(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// stripAccents removes combining marks after canonical decomposition.
+func stripAccents(text string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// enforceTokenLimit re-splits chunks whose text, with special tokens, exceeds
+// maxTokens so the embedder never truncates them. Pieces keep the chunk's
+// breadcrumb and get offsets within the original body. It returns the new
+// chunk list and how many chunks were oversized. maxTokens <= 0 disables the
+// check; with resplit false oversized chunks are only counted.
+func enforceTokenLimit(chunks []TextChunk, tokenizer Tokenizer, maxTokens int, resplit bool) ([]TextChunk, int, error) {
+	if maxTokens <= 0 {
+		return chunks, 0, nil
+	}
+	var result []TextChunk
+	oversized := 0
+	for _, ch := range chunks {
+		if tokenizer.Count(ch.Text)+embeddingSpecialTokens <= maxTokens {
+			result = append(result, ch)
+			continue
+		}
+		oversized++
+		if !resplit {
+			result = append(result, ch)
+			continue
+		}
+
+		body := chunkBody(ch.Text, ch.SectionPath)
+		budget := maxTokens - embeddingSpecialTokens
+		if ch.SectionPath != "" {
+			budget -= tokenizer.Count(ch.SectionPath)
+		}
+		if budget <= 0 {
+			result = append(result, ch)
+			continue
+		}
+		pieces, err := splitPlainText(body, budget, 0, tokenizer.Count)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, piece := range pieces {
+			start, end := -1, -1
+			if ch.Start >= 0 && piece.Start >= 0 {
+				start, end = ch.Start+piece.Start, ch.Start+piece.End
+			}
+			// Other attributes (section, language, symbol) carry over; the
+			// line range stays that of the whole chunk.
+			split := ch
+			split.Text = withBreadcrumb(ch.SectionPath, piece.Text)
+			split.Start, split.End = start, end
+			result = append(result, split)
+		}
+	}
+	return result, oversized, nil
+}